@@ -1,69 +1,37 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// HashPassword hashes password with DefaultPasswordParams.
 func HashPassword(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword(
-		[]byte(password),
-		bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashed), nil
+	return defaultHasher.Hash(password)
 }
 
+// CheckPasswordHash returns an error unless password matches hash, which may
+// have been made by any supported algorithm.
 func CheckPasswordHash(password, hash string) error {
-	h, p := []byte(hash), []byte(password)
-	return bcrypt.CompareHashAndPassword(h, p)
+	_, err := defaultHasher.Check(password, hash)
+	return err
 }
 
+// MakeJWT issues an HS256 access token signed with tokenSecret.
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	issueTime := time.Now().Local().UTC()
-	expireTime := issueTime.Add(expiresIn)
-	register := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  &jwt.NumericDate{Time: issueTime},
-		ExpiresAt: &jwt.NumericDate{Time: expireTime},
-		Subject:   userID.String(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, register)
-	stingToken, err := token.SignedString([]byte(tokenSecret))
-	if err != nil {
-		return "", err
-	}
-	return stingToken, nil
+	return NewHMACKeyring(tokenSecret).Issue(userID, 0, TokenUseAccess, expiresIn)
 }
 
+// ValidateJWT checks an HS256 access token signed with tokenSecret.
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected Signing Method: %v", t.Header["alg"])
-		}
-		return []byte(tokenSecret), nil
-	})
-
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if token.Valid && ok {
-		userID, err := uuid.Parse(claims.Subject)
-		if err != nil {
-			return uuid.Nil, err
-		}
-		return userID, nil
-	}
-	return uuid.Nil, fmt.Errorf("Invalid Token")
+	return NewHMACKeyring(tokenSecret).ValidateJWT(tokenString)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -85,3 +53,42 @@ func GetBearerToken(headers http.Header) (string, error) {
 	bearerToken := parts[1]
 	return bearerToken, nil
 }
+
+func MakeRefreshToken() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// HashRefreshToken returns the hash a refresh token is stored and looked up
+// by, so reading the table does not hand out sessions. Like personal access
+// tokens they are random, so a fast unsalted hash is enough.
+func HashRefreshToken(token string) string {
+	return hashToken(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func GetAPIKey(headers http.Header) (string, error) {
+	auth := headers.Get("Authorization")
+	if auth == "" {
+		return "", fmt.Errorf("Authorization header not present")
+	}
+
+	if !strings.HasPrefix(auth, "ApiKey ") {
+		return "", fmt.Errorf("Authorization header format must be 'ApiKey {key}'")
+	}
+
+	parts := strings.Fields(auth)
+
+	if len(parts) != 2 {
+		return "", fmt.Errorf("Authorization header must have exactly two parts")
+	}
+
+	return parts[1], nil
+}
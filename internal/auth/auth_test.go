@@ -2,6 +2,7 @@
 
 	import (
 		"math"
+		"net/http"
 		"testing"
 		"time"
 
@@ -218,3 +219,65 @@
 			}
 		})
 	}
+
+	func TestMakeRefreshToken(t *testing.T) {
+		t.Run("generates 256-bit hex token", func(t *testing.T) {
+			token, err := MakeRefreshToken()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if len(token) != 64 {
+				t.Errorf("Expected 64 hex characters, got %d: %s", len(token), token)
+			}
+		})
+
+		t.Run("generates unique tokens", func(t *testing.T) {
+			token1, err := MakeRefreshToken()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			token2, err := MakeRefreshToken()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if token1 == token2 {
+				t.Errorf("Expected different tokens, got the same token twice: %s", token1)
+			}
+		})
+	}
+
+	func TestGetAPIKey(t *testing.T) {
+		tests := map[string]struct {
+			header  string
+			want    string
+			wantErr bool
+		}{
+			"valid key":      {header: "ApiKey f271c81ff7084ee5b99a5091b42d486e", want: "f271c81ff7084ee5b99a5091b42d486e"},
+			"missing header": {header: "", wantErr: true},
+			"bearer scheme":  {header: "Bearer f271c81ff7084ee5b99a5091b42d486e", wantErr: true},
+			"extra parts":    {header: "ApiKey abc def", wantErr: true},
+		}
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				headers := http.Header{}
+				if tc.header != "" {
+					headers.Set("Authorization", tc.header)
+				}
+
+				key, err := GetAPIKey(headers)
+
+				if tc.wantErr {
+					if err == nil {
+						t.Errorf("Expected error, got nil")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+				if key != tc.want {
+					t.Errorf("Expected key %q, got: %q", tc.want, key)
+				}
+			})
+		}
+	}
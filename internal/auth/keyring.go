@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is one JWT signing key. Asymmetric keys are published in the JWKS
+// under their ID, which tokens carry in their "kid" header.
+type Key struct {
+	ID     string
+	method jwt.SigningMethod
+	// private is nil for keys that only verify.
+	private any
+	public  any
+	// issuedBefore, when set, limits the key to tokens issued no later and
+	// living no longer than maxLifetime. A retired shared secret is still
+	// known to whoever held it, so it must not vouch for new tokens.
+	issuedBefore time.Time
+	maxLifetime  time.Duration
+}
+
+// ParseKey reads a PEM encoded RSA or Ed25519 key. A private key can sign
+// and verify; a public key, such as a retiring key whose private half has
+// been destroyed, only verifies.
+func ParseKey(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %q: no PEM data", id)
+	}
+	var (
+		parsed any
+		err    error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("key %q: %w", id, err)
+	}
+
+	key := Key{ID: id}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.private, parsed = signer, signer.Public()
+	}
+	switch pub := parsed.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return Key{}, fmt.Errorf("key %q: RSA keys must be at least 2048 bits", id)
+		}
+		key.method, key.public = jwt.SigningMethodRS256, pub
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, pub
+	default:
+		return Key{}, fmt.Errorf("key %q: only RSA and Ed25519 keys are supported, got %T", id, pub)
+	}
+	return key, nil
+}
+
+// KeyFile names a PEM file holding a key and the ID to publish it under.
+type KeyFile struct {
+	ID   string
+	Path string
+}
+
+// ParseKeyFiles reads key files written as "<kid>=<path>" separated by
+// semicolons, e.g. "2024-06=keys/2024-06.pem; 2024-01=keys/2024-01.pub".
+func ParseKeyFiles(s string) ([]KeyFile, error) {
+	var files []KeyFile
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, path, ok := strings.Cut(entry, "=")
+		id, path = strings.TrimSpace(id), strings.TrimSpace(path)
+		if !ok || id == "" || path == "" {
+			return nil, fmt.Errorf("key %q: want <kid>=<path>", entry)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("key %q is listed twice", id)
+		}
+		seen[id] = true
+		files = append(files, KeyFile{ID: id, Path: path})
+	}
+	return files, nil
+}
+
+// Keyring signs access tokens with its current key and verifies them with
+// any key it holds. To rotate, put the new key first and keep the old one
+// until every token it signed has expired; keys left out are retired and
+// their tokens rejected.
+type Keyring struct {
+	// Policy sets the claims tokens are issued with and checked against.
+	Policy TokenPolicy
+
+	// keys[0] is the current key.
+	keys []Key
+}
+
+// NewKeyring returns a keyring that signs with current, which must hold a
+// private key, and also accepts tokens signed by previous.
+func NewKeyring(current Key, previous ...Key) (*Keyring, error) {
+	if current.private == nil {
+		return nil, fmt.Errorf("key %q cannot sign: it has no private key", current.ID)
+	}
+	k := &Keyring{Policy: DefaultTokenPolicy, keys: append([]Key{current}, previous...)}
+	seen := map[string]bool{}
+	for _, key := range k.keys {
+		if seen[key.ID] {
+			return nil, fmt.Errorf("key %q is listed twice", key.ID)
+		}
+		seen[key.ID] = true
+	}
+	return k, nil
+}
+
+// LoadKeyring reads each file with ParseKey; the first one signs. The other
+// files and previous only verify.
+func LoadKeyring(files []KeyFile, previous ...Key) (*Keyring, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no keys")
+	}
+	keys := make([]Key, len(files))
+	for i, f := range files {
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", f.ID, err)
+		}
+		if keys[i], err = ParseKey(f.ID, data); err != nil {
+			return nil, err
+		}
+	}
+	return NewKeyring(keys[0], append(keys[1:], previous...)...)
+}
+
+// NewHMACKeyring signs with HS256 and secret. Its tokens carry no kid and it
+// publishes nothing, since anyone who can verify them can also forge them.
+func NewHMACKeyring(secret string) *Keyring {
+	key := Key{method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+	return &Keyring{Policy: DefaultTokenPolicy, keys: []Key{key}}
+}
+
+// HMACVerifyKey accepts HS256 tokens a NewHMACKeyring with secret issued by
+// cutover that live no longer than maxLifetime, and signs nothing itself.
+// Listing it after asymmetric keys lets tokens issued before switching to
+// them keep working until they expire, which is at most maxLifetime after
+// cutover.
+func HMACVerifyKey(secret string, cutover time.Time, maxLifetime time.Duration) Key {
+	return Key{method: jwt.SigningMethodHS256, public: []byte(secret), issuedBefore: cutover, maxLifetime: maxLifetime}
+}
+
+// lookup finds the key t says it was signed with.
+func (k *Keyring) lookup(t *jwt.Token) (Key, error) {
+	kid, _ := t.Header["kid"].(string)
+	for _, key := range k.keys {
+		if key.ID != kid {
+			continue
+		}
+		if t.Method.Alg() != key.method.Alg() {
+			return Key{}, fmt.Errorf("%w: %v", ErrWrongAlgorithm, t.Header["alg"])
+		}
+		return key, nil
+	}
+	return Key{}, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+// checkRetiring rejects claims a key limited by HMACVerifyKey cannot have
+// issued.
+func (key Key) checkRetiring(claims *Claims) error {
+	if key.issuedBefore.IsZero() {
+		return nil
+	}
+	if claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return fmt.Errorf("%w: iat", ErrMissingClaim)
+	}
+	if claims.IssuedAt.After(key.issuedBefore) {
+		return fmt.Errorf("%w: issued at %s, after the key was retired", ErrRetiredKey, claims.IssuedAt.UTC().Format(time.RFC3339))
+	}
+	if claims.ExpiresAt.Sub(claims.IssuedAt.Time) > key.maxLifetime {
+		return fmt.Errorf("%w: lives longer than %s", ErrRetiredKey, key.maxLifetime)
+	}
+	return nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key, current key first.
+func (k *Keyring) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		if jwk, ok := key.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func (key Key) jwk() (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.method.Alg()}
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty, jwk.N, jwk.E = "RSA", b64(pub.N.Bytes()), b64(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty, jwk.Crv, jwk.X = "OKP", "Ed25519", b64(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
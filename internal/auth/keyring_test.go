@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func privatePEM(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func publicPEM(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func mustParseKey(t *testing.T, id string, data []byte) Key {
+	t.Helper()
+	key, err := ParseKey(id, data)
+	if err != nil {
+		t.Fatalf("Expected no error parsing key, got: %v", err)
+	}
+	return key
+}
+
+func TestKeyringRotation(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	oldKey := mustParseKey(t, "2024-01", privatePEM(t, rsaKey))
+	newKey := mustParseKey(t, "2024-06", privatePEM(t, edKey))
+	userID := uuid.New()
+
+	before, _ := NewKeyring(oldKey)
+	oldToken, err := before.Issue(userID, 0, TokenUseAccess, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// During rotation the new key signs and the old one, now public only,
+	// still verifies.
+	during, err := NewKeyring(newKey, mustParseKey(t, "2024-01", publicPEM(t, &rsaKey.PublicKey)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	newToken, _ := during.Issue(userID, 0, TokenUseAccess, time.Hour)
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	if parsed.Header["kid"] != "2024-06" || parsed.Header["alg"] != "EdDSA" {
+		t.Errorf("Expected an EdDSA token with kid 2024-06, got: %v", parsed.Header)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if got, err := during.ValidateJWT(token); err != nil || got != userID {
+			t.Errorf("Expected the %s token to validate during rotation, got: %v, %v", name, got, err)
+		}
+	}
+
+	jwks := during.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "2024-06" || jwks.Keys[1].Kid != "2024-01" {
+		t.Fatalf("Expected both keys in the JWKS, current first, got: %+v", jwks)
+	}
+	if jwk := jwks.Keys[0]; jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.X != base64.RawURLEncoding.EncodeToString(edPub) {
+		t.Errorf("Unexpected Ed25519 JWK: %+v", jwk)
+	}
+	if jwk := jwks.Keys[1]; jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.E != "AQAB" || jwk.N == "" {
+		t.Errorf("Unexpected RSA JWK: %+v", jwk)
+	}
+
+	after, _ := NewKeyring(newKey)
+	if _, err := after.ValidateJWT(oldToken); err == nil {
+		t.Error("Expected a token signed by a retired key to be rejected")
+	}
+}
+
+func TestKeyringMovingOffHMAC(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	userID := uuid.New()
+	oldToken, _ := NewHMACKeyring("secret").Issue(userID, 0, TokenUseAccess, time.Hour)
+	longToken, _ := NewHMACKeyring("secret").Issue(userID, 0, TokenUseAccess, 365*24*time.Hour)
+	current := mustParseKey(t, "2024-06", privatePEM(t, edKey))
+
+	keyring, err := NewKeyring(current, HMACVerifyKey("secret", time.Now().Add(time.Minute), time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got, err := keyring.ValidateJWT(oldToken); err != nil || got != userID {
+		t.Errorf("Expected the HS256 token to still validate, got: %v, %v", got, err)
+	}
+	newToken, _ := keyring.Issue(userID, 0, TokenUseAccess, time.Hour)
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	if parsed.Header["alg"] != "EdDSA" {
+		t.Errorf("Expected new tokens to be signed with EdDSA, got: %v", parsed.Header)
+	}
+	if len(keyring.JWKS().Keys) != 1 {
+		t.Errorf("Expected the HMAC key to stay unpublished, got: %+v", keyring.JWKS())
+	}
+	forged, _ := NewHMACKeyring("guess").Issue(userID, 0, TokenUseAccess, time.Hour)
+	if _, err := keyring.ValidateJWT(forged); err == nil {
+		t.Error("Expected an HS256 token signed with another secret to be rejected")
+	}
+	if _, err := keyring.ValidateJWT(longToken); !errors.Is(err, ErrRetiredKey) {
+		t.Errorf("Expected a token living longer than a session to be rejected, got: %v", err)
+	}
+	// Whoever still holds the secret cannot mint tokens after the cutover.
+	retired, _ := NewKeyring(current, HMACVerifyKey("secret", time.Now().Add(-time.Minute), time.Hour))
+	if _, err := retired.ValidateJWT(oldToken); !errors.Is(err, ErrRetiredKey) {
+		t.Errorf("Expected a token issued after the cutover to be rejected, got: %v", err)
+	}
+	if _, err := NewKeyring(HMACVerifyKey("secret", time.Now(), time.Hour)); err == nil {
+		t.Error("Expected a verify only HMAC key to be refused as the signing key")
+	}
+}
+
+func TestKeyringRejectsForgedTokens(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key := mustParseKey(t, "current", privatePEM(t, rsaKey))
+	keyring, _ := NewKeyring(key)
+	claims := jwt.RegisteredClaims{Subject: uuid.NewString(), ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+
+	// HS256 signed with the published public key must not pass as RS256.
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	confused.Header["kid"] = "current"
+	token, _ := confused.SignedString(publicPEM(t, &rsaKey.PublicKey))
+	if _, err := keyring.ValidateJWT(token); !errors.Is(err, ErrWrongAlgorithm) {
+		t.Errorf("Expected an algorithm mismatch error, got: %v", err)
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	unknown.Header["kid"] = "other"
+	token, _ = unknown.SignedString(rsaKey)
+	if _, err := keyring.ValidateJWT(token); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected an unknown key error, got: %v", err)
+	}
+
+	token, _ = NewHMACKeyring("secret").Issue(uuid.New(), 0, TokenUseAccess, time.Hour)
+	if _, err := keyring.ValidateJWT(token); err == nil {
+		t.Error("Expected an HS256 token without a kid to be rejected")
+	}
+	if len(NewHMACKeyring("secret").JWKS().Keys) != 0 {
+		t.Error("Expected an HMAC keyring to publish no keys")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	smallRSA, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	if _, err := NewKeyring(mustParseKey(t, "pub", publicPEM(t, edKey.Public()))); err == nil {
+		t.Error("Expected a public key to be refused as the signing key")
+	}
+	for name, tc := range map[string]struct {
+		data    []byte
+		wantErr string
+	}{
+		"not pem":   {[]byte("hunter2"), "no PEM data"},
+		"small rsa": {privatePEM(t, smallRSA), "at least 2048 bits"},
+		"cert":      {pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE"}), `unsupported PEM block "CERTIFICATE"`},
+	} {
+		if _, err := ParseKey(name, tc.data); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: expected error containing %q, got: %v", name, tc.wantErr, err)
+		}
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	os.WriteFile(filepath.Join(dir, "current.pem"), privatePEM(t, edKey), 0o600)
+
+	files, err := ParseKeyFiles(" current = " + filepath.Join(dir, "current.pem") + ";")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := LoadKeyring(files); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	if _, err := LoadKeyring([]KeyFile{{ID: "gone", Path: filepath.Join(dir, "gone.pem")}}); err == nil || !strings.Contains(err.Error(), `key "gone"`) {
+		t.Errorf("Expected a missing file error, got: %v", err)
+	}
+	for input, wantErr := range map[string]string{
+		"current.pem":      "want <kid>=<path>",
+		"a=x.pem; a=y.pem": `key "a" is listed twice`,
+		"=x.pem":           "want <kid>=<path>",
+		"a=":               "want <kid>=<path>",
+	} {
+		if _, err := ParseKeyFiles(input); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%q: expected error containing %q, got: %v", input, wantErr, err)
+		}
+	}
+}
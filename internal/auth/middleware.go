@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jdwalkerzhere/httpServer/internal/database"
+	"github.com/jdwalkerzhere/httpServer/internal/logging"
+	"github.com/jdwalkerzhere/httpServer/internal/response"
+)
+
+// Principal is who a request was authenticated as.
+type Principal struct {
+	User database.User
+	// Claims is set when the request carried an access token.
+	Claims *Claims
+	// Token is set when it carried a personal access token instead.
+	Token *database.PersonalAccessToken
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal the middleware stored in ctx. It
+// reports false for anonymous requests let through by Optional.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// MustPrincipal returns the principal of a request that passed Required. It
+// panics if there is none, which means the handler was mounted without it.
+func MustPrincipal(ctx context.Context) *Principal {
+	p, ok := PrincipalFrom(ctx)
+	if !ok {
+		panic("auth: no principal in context; is the handler behind Authenticator.Required?")
+	}
+	return p
+}
+
+// UserStore is what an Authenticator reads to check that a token has not
+// been revoked and to load its user.
+type UserStore interface {
+	GetUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetAccessTokenRevocation(ctx context.Context, arg database.GetAccessTokenRevocationParams) (database.GetAccessTokenRevocationRow, error)
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error)
+	TouchPersonalAccessToken(ctx context.Context, arg database.TouchPersonalAccessTokenParams) error
+}
+
+// errLookupFailed wraps store errors, which say nothing about the token.
+var errLookupFailed = errors.New("could not look up access token")
+
+// Authenticator turns bearer tokens, either JWT access tokens or personal
+// access tokens, into principals.
+type Authenticator struct {
+	keys  *Keyring
+	store UserStore
+	// Realm is sent in WWW-Authenticate challenges.
+	Realm string
+}
+
+func NewAuthenticator(keys *Keyring, store UserStore) *Authenticator {
+	return &Authenticator{keys: keys, store: store, Realm: "chirpy"}
+}
+
+// Authenticate checks an access token with the keyring, then that it has not
+// been revoked by logout, by its user logging out everywhere or changing
+// password, or by its user being deleted, and loads its user. Personal
+// access tokens are looked up instead.
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if strings.HasPrefix(token, PersonalTokenPrefix) {
+		return a.authenticatePersonal(ctx, token)
+	}
+	claims, err := a.keys.Parse(token, TokenUseAccess)
+	if err != nil {
+		return nil, err
+	}
+	id, err := claims.UserID()
+	if err != nil {
+		return nil, err
+	}
+	status, err := a.store.GetAccessTokenRevocation(ctx, database.GetAccessTokenRevocationParams{ID: id, Jti: claims.ID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: user no longer exists", ErrRevoked)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errLookupFailed, err)
+	}
+	if status.Revoked {
+		return nil, fmt.Errorf("%w: logged out", ErrRevoked)
+	}
+	if claims.TokenVersion != status.TokenVersion {
+		return nil, fmt.Errorf("%w: token version %d, user is at %d", ErrRevoked, claims.TokenVersion, status.TokenVersion)
+	}
+	user, err := a.store.GetUser(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: user no longer exists", ErrRevoked)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errLookupFailed, err)
+	}
+	return &Principal{User: user, Claims: claims}, nil
+}
+
+// Required rejects requests without a valid bearer token and passes the
+// rest to next with their Principal in the context.
+func (a *Authenticator) Required(next http.Handler) http.Handler {
+	return a.middleware(next, true)
+}
+
+// Optional lets requests without an Authorization header through
+// anonymously. A token that is present must still be valid: a client that
+// sent one expects to be treated as its user, not silently as nobody.
+func (a *Authenticator) Optional(next http.Handler) http.Handler {
+	return a.middleware(next, false)
+}
+
+func (a *Authenticator) middleware(next http.Handler, required bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !required && r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, err := GetBearerToken(r.Header)
+		if err != nil {
+			a.challenge(w, r, response.Error{
+				Status:  http.StatusUnauthorized,
+				Code:    response.CodeUnauthenticated,
+				Message: "User Not Logged In",
+			}, nil)
+			return
+		}
+		principal, err := a.Authenticate(r.Context(), token)
+		if errors.Is(err, errLookupFailed) {
+			logging.SetError(r.Context(), err)
+			response.WriteError(w, r, response.Error{
+				Status:  http.StatusInternalServerError,
+				Code:    response.CodeInternal,
+				Message: "Something went wrong",
+			})
+			return
+		}
+		if err != nil {
+			e := tokenError(err)
+			a.challenge(w, r, e, err, "error", "invalid_token", "error_description", e.Message)
+			return
+		}
+		logging.SetUserID(r.Context(), principal.User.ID.String())
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// tokenError says why a token was rejected when that helps the client
+// recover.
+func tokenError(err error) response.Error {
+	e := response.Error{Status: http.StatusUnauthorized, Code: response.CodeInvalidToken, Message: "Invalid JWT Token"}
+	switch {
+	case errors.Is(err, ErrExpired):
+		e.Code, e.Message = response.CodeTokenExpired, "Token has expired"
+	case errors.Is(err, ErrNotYetValid):
+		e.Message = "Token is not valid yet"
+	case errors.Is(err, ErrWrongIssuer):
+		e.Message = "Token was not issued by this server"
+	case errors.Is(err, ErrWrongAudience):
+		e.Message = "Token is not meant for this API"
+	case errors.Is(err, ErrWrongTokenUse):
+		e.Message = "Token is not an access token"
+	case errors.Is(err, ErrRevoked):
+		e.Message = "Token has been revoked"
+	case errors.Is(err, ErrUnknownToken):
+		e.Message = "Invalid personal access token"
+	}
+	return e
+}
+
+// RequireScope rejects principals whose personal access token was not
+// granted scope. It goes inside Required or Optional, and lets anonymous
+// requests through.
+func (a *Authenticator) RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := PrincipalFrom(r.Context()); ok && !p.HasScope(scope) {
+			msg := fmt.Sprintf("Token does not have the %s scope", scope)
+			a.challenge(w, r, response.Error{
+				Status:  http.StatusForbidden,
+				Code:    response.CodeInsufficientScope,
+				Message: msg,
+			}, nil, "error", "insufficient_scope", "error_description", msg, "scope", scope)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireSession rejects personal access tokens, for routes that manage
+// credentials or need a user who logged in themselves. It goes inside
+// Required.
+func (a *Authenticator) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := PrincipalFrom(r.Context()); ok && p.Token != nil {
+			msg := "Personal access tokens cannot be used here"
+			a.challenge(w, r, response.Error{
+				Status:  http.StatusForbidden,
+				Code:    response.CodeInsufficientScope,
+				Message: msg,
+			}, nil, "error", "insufficient_scope", "error_description", msg)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// challenge writes e with a WWW-Authenticate header as RFC 6750 describes.
+// params are the auth-params that follow the realm, as name, value pairs: a
+// bare challenge means no token was sent, and an error says why the one
+// that was sent was refused.
+func (a *Authenticator) challenge(w http.ResponseWriter, r *http.Request, e response.Error, err error, params ...string) {
+	header := fmt.Sprintf("Bearer realm=%q", a.Realm)
+	for i := 0; i+1 < len(params); i += 2 {
+		header += fmt.Sprintf(", %s=%q", params[i], params[i+1])
+	}
+	w.Header().Set("WWW-Authenticate", header)
+	if err != nil {
+		logging.SetError(r.Context(), err)
+	}
+	response.WriteError(w, r, e)
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jdwalkerzhere/httpServer/internal/database"
+)
+
+type fakeUserStore struct {
+	users map[uuid.UUID]database.User
+	// tokens are personal access tokens by hash.
+	tokens  map[string]database.PersonalAccessToken
+	touched int
+	err     error
+}
+
+func (s *fakeUserStore) GetUser(_ context.Context, id uuid.UUID) (database.User, error) {
+	if s.err != nil {
+		return database.User{}, s.err
+	}
+	user, ok := s.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *fakeUserStore) GetAccessTokenRevocation(_ context.Context, arg database.GetAccessTokenRevocationParams) (database.GetAccessTokenRevocationRow, error) {
+	if s.err != nil {
+		return database.GetAccessTokenRevocationRow{}, s.err
+	}
+	user, ok := s.users[arg.ID]
+	if !ok {
+		return database.GetAccessTokenRevocationRow{}, sql.ErrNoRows
+	}
+	return database.GetAccessTokenRevocationRow{TokenVersion: user.TokenVersion}, nil
+}
+
+func (s *fakeUserStore) GetPersonalAccessTokenByHash(_ context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	if s.err != nil {
+		return database.PersonalAccessToken{}, s.err
+	}
+	t, ok := s.tokens[tokenHash]
+	if !ok {
+		return database.PersonalAccessToken{}, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+func (s *fakeUserStore) TouchPersonalAccessToken(_ context.Context, arg database.TouchPersonalAccessTokenParams) error {
+	for hash, t := range s.tokens {
+		if t.ID == arg.ID {
+			t.LastUsedAt = arg.LastUsedAt
+			s.tokens[hash] = t
+			s.touched++
+		}
+	}
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	keys := NewHMACKeyring("test-secret-key")
+	user := database.User{ID: uuid.New(), Email: "jesse@pinkman.com", TokenVersion: 2}
+	store := &fakeUserStore{users: map[uuid.UUID]database.User{user.ID: user}}
+	authn := NewAuthenticator(keys, store)
+
+	valid, _ := keys.Issue(user.ID, 2, TokenUseAccess, time.Hour)
+	expired, _ := keys.Issue(user.ID, 2, TokenUseAccess, -time.Hour)
+	stale, _ := keys.Issue(user.ID, 1, TokenUseAccess, time.Hour)
+	deleted, _ := keys.Issue(uuid.New(), 0, TokenUseAccess, time.Hour)
+
+	var got *Principal
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFrom(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+	tests := []struct {
+		name          string
+		optional      bool
+		header        string
+		wantStatus    int
+		wantChallenge string
+		wantUser      bool
+	}{
+		{"valid", false, "Bearer " + valid, http.StatusNoContent, "", true},
+		{"no header", false, "", http.StatusUnauthorized, `Bearer realm="chirpy"`, false},
+		{"other scheme", false, "ApiKey " + valid, http.StatusUnauthorized, `Bearer realm="chirpy"`, false},
+		{"expired", false, "Bearer " + expired, http.StatusUnauthorized, `Bearer realm="chirpy", error="invalid_token", error_description="Token has expired"`, false},
+		{"stale version", false, "Bearer " + stale, http.StatusUnauthorized, `Bearer realm="chirpy", error="invalid_token", error_description="Token has been revoked"`, false},
+		{"deleted user", false, "Bearer " + deleted, http.StatusUnauthorized, `Bearer realm="chirpy", error="invalid_token", error_description="Token has been revoked"`, false},
+		{"optional anonymous", true, "", http.StatusNoContent, "", false},
+		{"optional valid", true, "Bearer " + valid, http.StatusNoContent, "", true},
+		{"optional garbage", true, "Bearer nope", http.StatusUnauthorized, `Bearer realm="chirpy", error="invalid_token", error_description="Invalid JWT Token"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			handler := authn.Required(next)
+			if tt.optional {
+				handler = authn.Optional(next)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got: %d", tt.wantStatus, rec.Code)
+			}
+			if challenge := rec.Header().Get("WWW-Authenticate"); challenge != tt.wantChallenge {
+				t.Errorf("Expected challenge %q, got: %q", tt.wantChallenge, challenge)
+			}
+			if tt.wantUser && (got == nil || got.User.ID != user.ID || got.Claims.Subject != user.ID.String()) {
+				t.Errorf("Expected the principal to be %s, got: %+v", user.ID, got)
+			}
+			if !tt.wantUser && got != nil {
+				t.Errorf("Expected no principal, got: %+v", got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareStoreFailure(t *testing.T) {
+	keys := NewHMACKeyring("test-secret-key")
+	authn := NewAuthenticator(keys, &fakeUserStore{err: errors.New("database is down")})
+	token, _ := keys.Issue(uuid.New(), 0, TokenUseAccess, time.Hour)
+
+	if _, err := authn.Authenticate(context.Background(), token); !errors.Is(err, errLookupFailed) {
+		t.Errorf("Expected a lookup error, got: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	authn.Required(http.NotFoundHandler()).ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("WWW-Authenticate") != "" {
+		t.Errorf("Expected a 500 without a challenge, got: %d %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestMustPrincipalPanicsWithoutMiddleware(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected MustPrincipal to panic on a context without a principal")
+		}
+	}()
+	MustPrincipal(context.Background())
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	user := database.User{ID: uuid.New(), Email: "badger@mayhew.com"}
+	store := &fakeUserStore{
+		users:  map[uuid.UUID]database.User{user.ID: user},
+		tokens: map[string]database.PersonalAccessToken{},
+	}
+	authn := NewAuthenticator(NewHMACKeyring("test-secret-key"), store)
+	issue := func(scopes string, edit func(*database.PersonalAccessToken)) string {
+		token, hash, err := MakePersonalAccessToken()
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		pat := database.PersonalAccessToken{ID: uuid.New(), UserID: user.ID, TokenHash: hash, Scopes: scopes}
+		if edit != nil {
+			edit(&pat)
+		}
+		store.tokens[hash] = pat
+		return token
+	}
+	writer := issue(JoinScopes([]string{ScopeChirpsRead, ScopeChirpsWrite}), nil)
+	reader := issue(ScopeChirpsRead, nil)
+	revoked := issue(ScopeChirpsWrite, func(p *database.PersonalAccessToken) {
+		p.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	})
+	expired := issue(ScopeChirpsWrite, func(p *database.PersonalAccessToken) {
+		p.ExpiresAt = sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+	})
+	jwt, _ := authn.keys.Issue(user.ID, 0, TokenUseAccess, time.Hour)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	write := authn.Required(authn.RequireScope(ScopeChirpsWrite, next))
+	session := authn.Required(authn.RequireSession(next))
+	tests := []struct {
+		name          string
+		handler       http.Handler
+		token         string
+		wantStatus    int
+		wantChallenge string
+	}{
+		{"scoped", write, writer, http.StatusNoContent, ""},
+		{"jwt has every scope", write, jwt, http.StatusNoContent, ""},
+		{"missing scope", write, reader, http.StatusForbidden, `Bearer realm="chirpy", error="insufficient_scope", error_description="Token does not have the chirps:write scope", scope="chirps:write"`},
+		{"session only", session, writer, http.StatusForbidden, `Bearer realm="chirpy", error="insufficient_scope", error_description="Personal access tokens cannot be used here"`},
+		{"jwt session", session, jwt, http.StatusNoContent, ""},
+		{"revoked", write, revoked, http.StatusUnauthorized, `Bearer realm="chirpy", error="invalid_token", error_description="Token has been revoked"`},
+		{"expired", write, expired, http.StatusUnauthorized, `Bearer realm="chirpy", error="invalid_token", error_description="Token has expired"`},
+		{"unknown", write, PersonalTokenPrefix + "deadbeef", http.StatusUnauthorized, `Bearer realm="chirpy", error="invalid_token", error_description="Invalid personal access token"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got: %d", tt.wantStatus, rec.Code)
+			}
+			if challenge := rec.Header().Get("WWW-Authenticate"); challenge != tt.wantChallenge {
+				t.Errorf("Expected challenge %q, got: %q", tt.wantChallenge, challenge)
+			}
+		})
+	}
+
+	// writer was used several times above but last_used_at is only written
+	// once a minute; reader once.
+	if store.touched != 2 {
+		t.Errorf("Expected last_used_at to be written twice, got: %d", store.touched)
+	}
+}
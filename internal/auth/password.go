@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms. Hashes record which one made them, along with
+// its parameters, so a PasswordHasher can check any of them and tell when
+// one was made with weaker settings than it now uses.
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// ErrPasswordMismatch is returned when a password does not match its hash.
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordParams configures how new password hashes are made.
+type PasswordParams struct {
+	Algorithm  string
+	BcryptCost int
+	// Argon2Memory is in KiB.
+	Argon2Memory  uint32
+	Argon2Time    uint32
+	Argon2Threads uint8
+}
+
+// DefaultPasswordParams follow the OWASP recommendation for Argon2id.
+var DefaultPasswordParams = PasswordParams{
+	Algorithm:     AlgorithmArgon2id,
+	BcryptCost:    12,
+	Argon2Memory:  19 * 1024,
+	Argon2Time:    2,
+	Argon2Threads: 1,
+}
+
+// Validate reports whether p describes a usable hasher.
+func (p PasswordParams) Validate() error {
+	switch p.Algorithm {
+	case AlgorithmArgon2id:
+		if p.Argon2Memory < 8*uint32(p.Argon2Threads) || p.Argon2Time < 1 || p.Argon2Threads < 1 {
+			return errors.New("argon2 time and threads must be positive and memory at least 8 KiB per thread")
+		}
+	case AlgorithmBcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("unknown password hash algorithm %q", p.Algorithm)
+	}
+	return nil
+}
+
+// PasswordHasher hashes passwords with its params and checks them against
+// hashes made with any supported algorithm.
+type PasswordHasher struct {
+	params PasswordParams
+	// dummyHash is a hash of a password nobody knows, computed on first use.
+	dummyHash func() string
+}
+
+func NewPasswordHasher(params PasswordParams) (*PasswordHasher, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	h := &PasswordHasher{params: params}
+	h.dummyHash = sync.OnceValue(func() string {
+		password, _ := MakeRefreshToken()
+		hash, _ := h.Hash(password)
+		return hash
+	})
+	return h, nil
+}
+
+var defaultHasher, _ = NewPasswordHasher(DefaultPasswordParams)
+
+// Hash returns an encoded hash of password. Argon2id hashes use the PHC
+// string format, "$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>".
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.params.Algorithm == AlgorithmBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.params.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hashed), nil
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := h.params
+	key := argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Argon2Memory, p.Argon2Time, p.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Check returns ErrPasswordMismatch if password does not match hash. When it
+// does, rehash reports whether hash was made with other settings than h's,
+// in which case the caller should replace it with h.Hash(password).
+func (h *PasswordHasher) Check(password, hash string) (rehash bool, err error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return h.checkArgon2id(password, hash)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, ErrPasswordMismatch
+	}
+	if err != nil {
+		return false, err
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, err
+	}
+	return h.params.Algorithm != AlgorithmBcrypt || cost != h.params.BcryptCost, nil
+}
+
+func (h *PasswordHasher) checkArgon2id(password, hash string) (bool, error) {
+	errMalformed := errors.New("malformed argon2id hash")
+	fields := strings.Split(hash, "$")
+	if len(fields) != 6 {
+		return false, errMalformed
+	}
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2 version %q", fields[2])
+	}
+	var (
+		memory, time uint32
+		threads      uint8
+	)
+	if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || time < 1 || threads < 1 {
+		return false, errMalformed
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return false, errMalformed
+	}
+	key, err := base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(key) == 0 {
+		return false, errMalformed
+	}
+
+	got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return false, ErrPasswordMismatch
+	}
+	p := h.params
+	return p.Algorithm != AlgorithmArgon2id ||
+		memory != p.Argon2Memory ||
+		time != p.Argon2Time ||
+		threads != p.Argon2Threads ||
+		len(salt) != argon2SaltLen ||
+		len(key) != argon2KeyLen, nil
+}
+
+// CheckDummy does the same work as a failed Check, so a login for an email
+// that does not exist takes as long as one with the wrong password.
+func (h *PasswordHasher) CheckDummy(password string) {
+	h.Check(password, h.dummyHash())
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	bcrypt4 := PasswordParams{Algorithm: AlgorithmBcrypt, BcryptCost: 4}
+	bcrypt5 := PasswordParams{Algorithm: AlgorithmBcrypt, BcryptCost: 5}
+	argon := PasswordParams{Algorithm: AlgorithmArgon2id, Argon2Memory: 64, Argon2Time: 1, Argon2Threads: 1}
+	stronger := argon
+	stronger.Argon2Time = 2
+
+	tests := map[string]struct {
+		made, checked PasswordParams
+		wantPrefix    string
+		wantRehash    bool
+	}{
+		"same bcrypt cost":        {bcrypt4, bcrypt4, "$2a$04$", false},
+		"higher bcrypt cost":      {bcrypt4, bcrypt5, "$2a$04$", true},
+		"bcrypt to argon2id":      {bcrypt4, argon, "$2a$04$", true},
+		"same argon2id params":    {argon, argon, "$argon2id$v=19$m=64,t=1,p=1$", false},
+		"more argon2id passes":    {argon, stronger, "$argon2id$v=19$m=64,t=1,p=1$", true},
+		"argon2id back to bcrypt": {argon, bcrypt4, "$argon2id$", true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			maker, err := NewPasswordHasher(tc.made)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			checker, err := NewPasswordHasher(tc.checked)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			hash, err := maker.Hash("correct horse battery staple")
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if !strings.HasPrefix(hash, tc.wantPrefix) {
+				t.Errorf("Expected hash starting %q, got: %s", tc.wantPrefix, hash)
+			}
+
+			rehash, err := checker.Check("correct horse battery staple", hash)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if rehash != tc.wantRehash {
+				t.Errorf("Expected rehash %v, got: %v", tc.wantRehash, rehash)
+			}
+			if _, err := checker.Check("incorrect horse", hash); !errors.Is(err, ErrPasswordMismatch) {
+				t.Errorf("Expected ErrPasswordMismatch, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherRejectsMalformedHashes(t *testing.T) {
+	h, _ := NewPasswordHasher(DefaultPasswordParams)
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+	} {
+		if _, err := h.Check("password", hash); err == nil || errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("%q: expected a malformed hash error, got: %v", hash, err)
+		}
+	}
+}
+
+func TestPasswordParamsValidate(t *testing.T) {
+	for _, p := range []PasswordParams{
+		{Algorithm: "scrypt"},
+		{Algorithm: AlgorithmBcrypt, BcryptCost: 3},
+		{Algorithm: AlgorithmBcrypt, BcryptCost: 32},
+		{Algorithm: AlgorithmArgon2id, Argon2Memory: 64, Argon2Time: 0, Argon2Threads: 1},
+		{Algorithm: AlgorithmArgon2id, Argon2Memory: 64, Argon2Time: 1, Argon2Threads: 0},
+		{Algorithm: AlgorithmArgon2id, Argon2Memory: 8, Argon2Time: 1, Argon2Threads: 2},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", p)
+		}
+	}
+}
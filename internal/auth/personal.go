@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jdwalkerzhere/httpServer/internal/database"
+	"github.com/jdwalkerzhere/httpServer/internal/logging"
+)
+
+// PersonalTokenPrefix starts every personal access token, so the auth path
+// can tell them from JWTs and secret scanners can spot leaked ones.
+const PersonalTokenPrefix = "chirpy_pat_"
+
+// Scopes a personal access token can be granted. Access tokens from logging
+// in carry all of them. Chirps are public, so no route checks chirps:read,
+// and a user's email and password are credentials only a session may change,
+// so none checks profile:write either; both are kept so tokens granted them
+// stay valid.
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+// Scopes lists every scope a personal access token can be granted.
+var Scopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// ErrUnknownToken is returned for a personal access token that was never
+// issued.
+var ErrUnknownToken = errors.New("token does not exist")
+
+// touchInterval limits how often a token's last_used_at is written, so a
+// busy bot does not cost a write on every request.
+const touchInterval = time.Minute
+
+// MakePersonalAccessToken returns a new personal access token and the hash
+// to store in its place.
+func MakePersonalAccessToken() (token, hash string, err error) {
+	secret, err := MakeRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	token = PersonalTokenPrefix + secret
+	return token, HashPersonalAccessToken(token), nil
+}
+
+// HashPersonalAccessToken returns the hash a token is stored and looked up
+// by. Tokens carry 256 random bits, so unlike passwords they need no salt or
+// slow hash to resist guessing.
+func HashPersonalAccessToken(token string) string {
+	return hashToken(token)
+}
+
+// JoinScopes encodes scopes for storage, space separated as in OAuth.
+func JoinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// SplitScopes decodes scopes stored by JoinScopes.
+func SplitScopes(s string) []string {
+	return strings.Fields(s)
+}
+
+// HasScope reports whether p may act with scope.
+func (p *Principal) HasScope(scope string) bool {
+	if p.Token == nil {
+		return true
+	}
+	return slices.Contains(SplitScopes(p.Token.Scopes), scope)
+}
+
+// authenticatePersonal looks a personal access token up by its hash and
+// loads its user.
+func (a *Authenticator) authenticatePersonal(ctx context.Context, token string) (*Principal, error) {
+	pat, err := a.store.GetPersonalAccessTokenByHash(ctx, HashPersonalAccessToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnknownToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errLookupFailed, err)
+	}
+	now := time.Now()
+	if pat.RevokedAt.Valid {
+		return nil, fmt.Errorf("%w: personal access token %s", ErrRevoked, pat.ID)
+	}
+	if pat.ExpiresAt.Valid && now.After(pat.ExpiresAt.Time) {
+		return nil, fmt.Errorf("%w: personal access token %s", ErrExpired, pat.ID)
+	}
+	user, err := a.store.GetUser(ctx, pat.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: user no longer exists", ErrRevoked)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errLookupFailed, err)
+	}
+	if !pat.LastUsedAt.Valid || now.Sub(pat.LastUsedAt.Time) >= touchInterval {
+		pat.LastUsedAt = sql.NullTime{Time: now, Valid: true}
+		err := a.store.TouchPersonalAccessToken(ctx, database.TouchPersonalAccessTokenParams{ID: pat.ID, LastUsedAt: pat.LastUsedAt})
+		if err != nil {
+			logging.AddAttrs(ctx, slog.String("touch_error", err.Error()))
+		}
+	}
+	return &Principal{User: user, Token: &pat}, nil
+}
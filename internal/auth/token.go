@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Reasons a token is rejected. Check them with errors.Is.
+var (
+	ErrMalformedToken = jwt.ErrTokenMalformed
+	ErrBadSignature   = jwt.ErrTokenSignatureInvalid
+	ErrExpired        = jwt.ErrTokenExpired
+	ErrNotYetValid    = jwt.ErrTokenNotValidYet
+	ErrWrongIssuer    = jwt.ErrTokenInvalidIssuer
+	ErrWrongAudience  = jwt.ErrTokenInvalidAudience
+	ErrMissingClaim   = jwt.ErrTokenRequiredClaimMissing
+	ErrWrongTokenUse  = errors.New("token has the wrong token_use")
+	ErrRevoked        = errors.New("token has been revoked")
+	ErrUnknownKey     = errors.New("token is signed by an unknown key")
+	ErrWrongAlgorithm = errors.New("token is signed with the wrong algorithm for its key")
+	ErrRetiredKey     = errors.New("token could not have been issued before its key was retired")
+)
+
+// TokenUse says what a token is for, so one kind cannot stand in for
+// another even though they are signed by the same keys.
+type TokenUse string
+
+const (
+	TokenUseAccess        TokenUse = "access"
+	TokenUseRefresh       TokenUse = "refresh"
+	TokenUsePasswordReset TokenUse = "password_reset"
+)
+
+// TokenPolicy is what tokens are issued with and required to carry.
+type TokenPolicy struct {
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+var DefaultTokenPolicy = TokenPolicy{
+	Issuer:   "chirpy",
+	Audience: "chirpy-api",
+	Leeway:   30 * time.Second,
+}
+
+// Claims are the claims in every token the keyring issues.
+type Claims struct {
+	jwt.RegisteredClaims
+	TokenUse TokenUse `json:"token_use"`
+	// TokenVersion is the user's token version when the token was issued;
+	// bumping the version revokes every token issued before.
+	TokenVersion int32 `json:"ver"`
+}
+
+// UserID returns the subject the token was issued to.
+func (c *Claims) UserID() (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: sub is not a user ID", ErrMalformedToken)
+	}
+	return id, nil
+}
+
+// Issue signs a token for userID at their current token version with the
+// current key. It is valid for use from now until ttl has passed and has a
+// unique jti.
+func (k *Keyring) Issue(userID uuid.UUID, version int32, use TokenUse, ttl time.Duration) (string, error) {
+	now := time.Now().UTC()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    k.Policy.Issuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{k.Policy.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			ID:        uuid.NewString(),
+		},
+		TokenUse:     use,
+		TokenVersion: version,
+	}
+	current := k.keys[0]
+	token := jwt.NewWithClaims(current.method, claims)
+	if current.ID != "" {
+		token.Header["kid"] = current.ID
+	}
+	return token.SignedString(current.private)
+}
+
+// Parse verifies a token's signature and claims and that it was issued for
+// use. Errors wrap one of the Err* reasons above.
+func (k *Keyring) Parse(tokenString string, use TokenUse) (*Claims, error) {
+	claims := &Claims{}
+	var key Key
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
+		var err error
+		key, err = k.lookup(t)
+		return key.public, err
+	},
+		jwt.WithIssuer(k.Policy.Issuer),
+		jwt.WithAudience(k.Policy.Audience),
+		jwt.WithLeeway(k.Policy.Leeway),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.checkRetiring(claims); err != nil {
+		return nil, err
+	}
+	if claims.TokenUse != use {
+		return nil, fmt.Errorf("%w: want %q, got %q", ErrWrongTokenUse, use, claims.TokenUse)
+	}
+	if claims.ID == "" {
+		return nil, fmt.Errorf("%w: jti", ErrMissingClaim)
+	}
+	return claims, nil
+}
+
+// ValidateJWT returns the user an access token was issued to.
+func (k *Keyring) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := k.Parse(tokenString, TokenUseAccess)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID()
+}
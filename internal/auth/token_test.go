@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestParseRejects(t *testing.T) {
+	keyring := NewHMACKeyring("test-secret-key")
+	userID := uuid.New()
+	sign := func(edit func(*Claims)) string {
+		now := time.Now()
+		claims := Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "chirpy",
+				Subject:   userID.String(),
+				Audience:  jwt.ClaimStrings{"chirpy-api"},
+				NotBefore: jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+				ID:        uuid.NewString(),
+			},
+			TokenUse: TokenUseAccess,
+		}
+		edit(&claims)
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret-key"))
+		return token
+	}
+
+	tests := map[string]struct {
+		token   string
+		wantErr error
+	}{
+		"expired":        {sign(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }), ErrExpired},
+		"no expiry":      {sign(func(c *Claims) { c.ExpiresAt = nil }), ErrMissingClaim},
+		"not yet valid":  {sign(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute)) }), ErrNotYetValid},
+		"wrong issuer":   {sign(func(c *Claims) { c.Issuer = "evil" }), ErrWrongIssuer},
+		"wrong audience": {sign(func(c *Claims) { c.Audience = jwt.ClaimStrings{"billing-api"} }), ErrWrongAudience},
+		"no audience":    {sign(func(c *Claims) { c.Audience = nil }), ErrMissingClaim},
+		"refresh token":  {sign(func(c *Claims) { c.TokenUse = TokenUseRefresh }), ErrWrongTokenUse},
+		"no token use":   {sign(func(c *Claims) { c.TokenUse = "" }), ErrWrongTokenUse},
+		"no jti":         {sign(func(c *Claims) { c.ID = "" }), ErrMissingClaim},
+		"bad subject":    {sign(func(c *Claims) { c.Subject = "saul" }), ErrMalformedToken},
+		"garbage":        {"not.a.token", ErrMalformedToken},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := keyring.ValidateJWT(tc.token)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Expected %v, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	within := sign(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Second)) })
+	if got, err := keyring.ValidateJWT(within); err != nil || got != userID {
+		t.Errorf("Expected a token expired within the leeway to pass, got: %v, %v", got, err)
+	}
+}
+
+func TestIssueClaims(t *testing.T) {
+	keyring := NewHMACKeyring("test-secret-key")
+	keyring.Policy = TokenPolicy{Issuer: "https://chirpy.example", Audience: "chirps"}
+	userID := uuid.New()
+
+	token, err := keyring.Issue(userID, 0, TokenUsePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	claims, err := keyring.Parse(token, TokenUsePasswordReset)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if claims.Issuer != "https://chirpy.example" || len(claims.Audience) != 1 || claims.Audience[0] != "chirps" || claims.ID == "" || claims.NotBefore == nil {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+	if _, err := keyring.ValidateJWT(token); !errors.Is(err, ErrWrongTokenUse) {
+		t.Errorf("Expected a password reset token to be refused as an access token, got: %v", err)
+	}
+
+	other, _ := keyring.Issue(userID, 0, TokenUseAccess, time.Hour)
+	if again, _ := keyring.Parse(other, TokenUseAccess); again.ID == claims.ID {
+		t.Error("Expected every token to get its own jti")
+	}
+}
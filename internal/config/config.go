@@ -0,0 +1,467 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jdwalkerzhere/httpServer/internal/auth"
+	"github.com/jdwalkerzhere/httpServer/internal/ratelimit"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const minAuthSecretLength = 32
+
+// Config is the validated server configuration. Every field tagged with
+// `config` can be set from a config file (by its key), the environment or
+// .env (by its upper-cased key) and a command-line flag (by its key with
+// dashes instead of underscores).
+type Config struct {
+	ListenAddr         string        `config:"listen_addr" usage:"address the HTTP server listens on"`
+	Store              string        `config:"store" usage:"storage backend: postgres, sqlite or memory"`
+	DBURL              string        `config:"db_url" redact:"url" usage:"Postgres connection URL"`
+	SQLitePath         string        `config:"sqlite_path" usage:"database file used by the sqlite store"`
+	AutoMigrate        bool          `config:"auto_migrate" usage:"apply pending Postgres migrations on startup"`
+	DBMaxOpenConns     int           `config:"db_max_open_conns" usage:"maximum open database connections"`
+	DBMaxIdleConns     int           `config:"db_max_idle_conns" usage:"maximum idle database connections"`
+	DBConnMaxLifetime  time.Duration `config:"db_conn_max_lifetime" usage:"maximum lifetime of a database connection"`
+	AuthSecret         string        `config:"auth_secret" redact:"true" usage:"HMAC key used to sign cursors, and access tokens unless jwt_keys is set"`
+	JWTKeys            string        `config:"jwt_keys" usage:"RS256 or EdDSA keys as \"<kid>=<pem file>\" separated by semicolons; the first signs access tokens, the rest only verify them"`
+	JWTHMACCutover     string        `config:"jwt_hmac_cutover" usage:"RFC 3339 time jwt_keys replaced auth_secret for signing access tokens; access tokens auth_secret signed by then stay valid until they expire. Remove it once access_token_ttl has passed"`
+	JWTIssuer          string        `config:"jwt_issuer" usage:"iss claim access tokens are issued with and must carry"`
+	JWTAudience        string        `config:"jwt_audience" usage:"aud claim access tokens are issued with and must carry"`
+	JWTLeeway          time.Duration `config:"jwt_leeway" usage:"clock skew tolerated when checking token expiry and not-before times"`
+	PolkaKey           string        `config:"polka_key" redact:"true" usage:"API key Polka uses to call the payment webhook"`
+	Platform           string        `config:"platform" usage:"deployment platform; only \"dev\" allows /admin/reset"`
+	StaticDir          string        `config:"static_dir" usage:"directory holding index.html and assets/ to serve under /app/ instead of the embedded copies"`
+	AccessTokenTTL     time.Duration `config:"access_token_ttl" usage:"lifetime of access tokens"`
+	RefreshTokenTTL    time.Duration `config:"refresh_token_ttl" usage:"lifetime of refresh tokens"`
+	PasswordMinLength  int           `config:"password_min_length" usage:"minimum password length in characters"`
+	PasswordMinEntropy int           `config:"password_min_entropy" usage:"minimum estimated password strength in bits"`
+	PasswordHash       string        `config:"password_hash" usage:"algorithm for new password hashes: argon2id or bcrypt; older hashes are upgraded on login"`
+	BcryptCost         int           `config:"bcrypt_cost" usage:"bcrypt cost factor when password_hash is bcrypt"`
+	Argon2Memory       int           `config:"argon2_memory" usage:"Argon2id memory in KiB"`
+	Argon2Time         int           `config:"argon2_time" usage:"Argon2id passes over memory"`
+	Argon2Threads      int           `config:"argon2_threads" usage:"Argon2id parallelism"`
+	LockoutThreshold   int           `config:"lockout_threshold" usage:"consecutive failed logins before an account is locked"`
+	LockoutBase        time.Duration `config:"lockout_base" usage:"first lockout period; it doubles with each further failure"`
+	LockoutMax         time.Duration `config:"lockout_max" usage:"longest lockout period"`
+	ReadTimeout        time.Duration `config:"read_timeout" usage:"maximum duration for reading a request"`
+	WriteTimeout       time.Duration `config:"write_timeout" usage:"maximum duration for writing a response"`
+	IdleTimeout        time.Duration `config:"idle_timeout" usage:"maximum keep-alive idle time"`
+	ShutdownTimeout    time.Duration `config:"shutdown_timeout" usage:"how long to wait for in-flight requests on shutdown"`
+	MaxHeaderBytes     int           `config:"max_header_bytes" usage:"maximum size of request headers"`
+	LogLevel           string        `config:"log_level" usage:"minimum log level: debug, info, warn or error"`
+	LogFormat          string        `config:"log_format" usage:"log output format: text or json"`
+	MetricsPublic      bool          `config:"metrics_public" usage:"serve GET /metrics to anyone instead of only to admins and metrics_token; set it only when the listen address is not reachable from the internet"`
+	MetricsToken       string        `config:"metrics_token" redact:"true" usage:"bearer token scrapers such as Prometheus send to read GET /metrics without an admin login"`
+	RateLimits         string        `config:"rate_limits" usage:"per-route token buckets as \"<route>=<limit>/<window>\" separated by semicolons; \"*\" sets the default"`
+
+	// PrintConfig is only settable with --print-config.
+	PrintConfig bool
+	// Args are the positional arguments left after flags, such as a
+	// subcommand.
+	Args []string
+}
+
+func Default() Config {
+	return Config{
+		ListenAddr:         ":8080",
+		Store:              "postgres",
+		SQLitePath:         "chirpy.db",
+		DBMaxOpenConns:     10,
+		DBMaxIdleConns:     5,
+		DBConnMaxLifetime:  30 * time.Minute,
+		Platform:           "prod",
+		AccessTokenTTL:     time.Hour,
+		RefreshTokenTTL:    60 * 24 * time.Hour,
+		JWTIssuer:          auth.DefaultTokenPolicy.Issuer,
+		JWTAudience:        auth.DefaultTokenPolicy.Audience,
+		JWTLeeway:          auth.DefaultTokenPolicy.Leeway,
+		PasswordMinLength:  8,
+		PasswordMinEntropy: 35,
+		PasswordHash:       auth.DefaultPasswordParams.Algorithm,
+		BcryptCost:         auth.DefaultPasswordParams.BcryptCost,
+		Argon2Memory:       int(auth.DefaultPasswordParams.Argon2Memory),
+		Argon2Time:         int(auth.DefaultPasswordParams.Argon2Time),
+		Argon2Threads:      int(auth.DefaultPasswordParams.Argon2Threads),
+		LockoutThreshold:   5,
+		LockoutBase:        time.Minute,
+		LockoutMax:         time.Hour,
+		ReadTimeout:        10 * time.Second,
+		WriteTimeout:       30 * time.Second,
+		IdleTimeout:        120 * time.Second,
+		ShutdownTimeout:    10 * time.Second,
+		MaxHeaderBytes:     1 << 20,
+		LogLevel:           "info",
+		LogFormat:          "text",
+		RateLimits:         "POST /api/login=10/1m; POST /api/users=10/1h; POST /api/refresh=30/1m; POST /api/chirps=60/1m",
+	}
+}
+
+// Load builds a Config from, in increasing order of precedence: built-in
+// defaults, the optional config file (--config or CONFIG_FILE), the .env
+// file, the process environment and command-line flags.
+func Load(args []string) (Config, error) {
+	return load(args, os.LookupEnv)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+	fields := configFields()
+
+	flags := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	configFile := flags.String("config", "", "path to a YAML or TOML config file")
+	envFile := flags.String("env-file", ".env", "path to a dotenv file; ignored if missing")
+	flags.BoolVar(&cfg.PrintConfig, "print-config", false, "print the resolved configuration with secrets redacted and exit")
+	flagValues := map[string]*string{}
+	for _, f := range fields {
+		flagValues[f.key] = flags.String(strings.ReplaceAll(f.key, "_", "-"), f.get(&cfg), f.usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+	cfg.Args = flags.Args()
+
+	if *configFile == "" {
+		*configFile, _ = lookupEnv("CONFIG_FILE")
+	}
+	if *configFile != "" {
+		values, err := readConfigFile(*configFile)
+		if err != nil {
+			return cfg, err
+		}
+		if err := apply(&cfg, fields, values); err != nil {
+			return cfg, fmt.Errorf("%s: %w", *configFile, err)
+		}
+	}
+
+	dotenv, err := godotenv.Read(*envFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return cfg, fmt.Errorf("reading %s: %w", *envFile, err)
+	}
+	if err := apply(&cfg, fields, envValues(fields, func(key string) (string, bool) {
+		v, ok := dotenv[key]
+		return v, ok
+	})); err != nil {
+		return cfg, fmt.Errorf("%s: %w", *envFile, err)
+	}
+	if err := apply(&cfg, fields, envValues(fields, lookupEnv)); err != nil {
+		return cfg, fmt.Errorf("environment: %w", err)
+	}
+
+	set := map[string]string{}
+	flags.Visit(func(f *flag.Flag) {
+		key := strings.ReplaceAll(f.Name, "-", "_")
+		if v, ok := flagValues[key]; ok {
+			set[key] = *v
+		}
+	})
+	if err := apply(&cfg, fields, set); err != nil {
+		return cfg, fmt.Errorf("flags: %w", err)
+	}
+
+	if len(cfg.Args) > 0 && cfg.Args[0] == "migrate" {
+		return cfg, cfg.ValidateMigrate()
+	}
+	return cfg, cfg.Validate()
+}
+
+// ValidateMigrate reports every problem with the settings the migrate
+// subcommand uses: the store and logging. It needs no secrets, so migrations
+// can run from a job that is not trusted with them.
+func (c Config) ValidateMigrate() error {
+	var errs []error
+	switch c.Store {
+	case "postgres":
+		if c.DBURL == "" {
+			errs = append(errs, errors.New("db_url must be set"))
+		}
+	case "sqlite":
+		if c.SQLitePath == "" {
+			errs = append(errs, errors.New("sqlite_path must be set"))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("store must be postgres, sqlite or memory, got %q", c.Store))
+	}
+	if c.DBMaxOpenConns < 1 {
+		errs = append(errs, errors.New("db_max_open_conns must be positive"))
+	}
+	if c.DBMaxIdleConns < 0 || c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errs = append(errs, errors.New("db_max_idle_conns must be between 0 and db_max_open_conns"))
+	}
+	if c.DBConnMaxLifetime <= 0 {
+		errs = append(errs, errors.New("db_conn_max_lifetime must be positive"))
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log_level must be debug, info, warn or error, got %q", c.LogLevel))
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("log_format must be \"text\" or \"json\", got %q", c.LogFormat))
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every problem with c at once.
+func (c Config) Validate() error {
+	errs := []error{c.ValidateMigrate()}
+	if c.ListenAddr == "" {
+		errs = append(errs, errors.New("listen_addr must be set"))
+	}
+	if len(c.AuthSecret) < minAuthSecretLength {
+		errs = append(errs, fmt.Errorf("auth_secret must be at least %d bytes, got %d", minAuthSecretLength, len(c.AuthSecret)))
+	}
+	if c.Platform != "dev" && c.Platform != "prod" {
+		errs = append(errs, fmt.Errorf("platform must be \"dev\" or \"prod\", got %q", c.Platform))
+	}
+	if _, err := auth.ParseKeyFiles(c.JWTKeys); err != nil {
+		errs = append(errs, fmt.Errorf("jwt_keys: %w", err))
+	}
+	if cutover, err := c.HMACCutover(); err != nil {
+		errs = append(errs, err)
+	} else if !cutover.IsZero() && c.JWTKeys == "" {
+		errs = append(errs, errors.New("jwt_hmac_cutover only applies with jwt_keys"))
+	} else if cutover.After(time.Now()) {
+		errs = append(errs, errors.New("jwt_hmac_cutover must not be in the future"))
+	}
+	if strings.TrimSpace(c.JWTIssuer) == "" || strings.TrimSpace(c.JWTAudience) == "" {
+		errs = append(errs, errors.New("jwt_issuer and jwt_audience must be set"))
+	}
+	if c.JWTLeeway < 0 {
+		errs = append(errs, errors.New("jwt_leeway must not be negative"))
+	}
+	if _, err := ratelimit.ParsePolicies(c.RateLimits); err != nil {
+		errs = append(errs, fmt.Errorf("rate_limits: %w", err))
+	}
+	if c.PasswordMinLength < 1 {
+		errs = append(errs, errors.New("password_min_length must be positive"))
+	}
+	if c.PasswordMinEntropy < 0 {
+		errs = append(errs, errors.New("password_min_entropy must not be negative"))
+	}
+	if c.Argon2Memory < 0 || c.Argon2Memory > math.MaxUint32 || c.Argon2Time < 0 || c.Argon2Time > math.MaxUint32 || c.Argon2Threads < 0 || c.Argon2Threads > math.MaxUint8 {
+		errs = append(errs, errors.New("argon2_memory, argon2_time and argon2_threads are out of range"))
+	} else if err := c.PasswordParams().Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("password hashing: %w", err))
+	}
+	if c.LockoutThreshold < 1 {
+		errs = append(errs, errors.New("lockout_threshold must be positive"))
+	}
+	if c.LockoutMax < c.LockoutBase {
+		errs = append(errs, errors.New("lockout_max must not be less than lockout_base"))
+	}
+	if c.MaxHeaderBytes < 1 {
+		errs = append(errs, errors.New("max_header_bytes must be positive"))
+	}
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"access_token_ttl", c.AccessTokenTTL},
+		{"refresh_token_ttl", c.RefreshTokenTTL},
+		{"lockout_base", c.LockoutBase},
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout},
+		{"shutdown_timeout", c.ShutdownTimeout},
+	} {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", d.key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TokenPolicy returns the claims access tokens are issued with and checked
+// against.
+func (c Config) TokenPolicy() auth.TokenPolicy {
+	return auth.TokenPolicy{Issuer: c.JWTIssuer, Audience: c.JWTAudience, Leeway: c.JWTLeeway}
+}
+
+// HMACCutover returns when jwt_keys took over signing from auth_secret, or
+// the zero time if access tokens signed with auth_secret are not accepted.
+func (c Config) HMACCutover() (time.Time, error) {
+	if c.JWTHMACCutover == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, c.JWTHMACCutover)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("jwt_hmac_cutover: %q is not an RFC 3339 time", c.JWTHMACCutover)
+	}
+	return t, nil
+}
+
+// PasswordParams returns the settings for new password hashes.
+func (c Config) PasswordParams() auth.PasswordParams {
+	return auth.PasswordParams{
+		Algorithm:     c.PasswordHash,
+		BcryptCost:    c.BcryptCost,
+		Argon2Memory:  uint32(c.Argon2Memory),
+		Argon2Time:    uint32(c.Argon2Time),
+		Argon2Threads: uint8(c.Argon2Threads),
+	}
+}
+
+// Redacted renders c as "key: value" lines with secrets masked, suitable for
+// --print-config.
+func (c Config) Redacted() string {
+	var b strings.Builder
+	for _, f := range configFields() {
+		v := f.get(&c)
+		switch {
+		case v == "":
+		case f.redact == "url":
+			if u, err := url.Parse(v); err == nil {
+				v = u.Redacted()
+			} else {
+				v = "[REDACTED]"
+			}
+		case f.redact != "":
+			v = "[REDACTED]"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", f.key, v)
+	}
+	return b.String()
+}
+
+type field struct {
+	key    string
+	usage  string
+	redact string
+	index  int
+}
+
+func configFields() []field {
+	var fields []field
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key, ok := sf.Tag.Lookup("config")
+		if !ok {
+			continue
+		}
+		fields = append(fields, field{
+			key:    key,
+			usage:  sf.Tag.Get("usage"),
+			redact: sf.Tag.Get("redact"),
+			index:  i,
+		})
+	}
+	return fields
+}
+
+func (f field) get(c *Config) string {
+	v := reflect.ValueOf(c).Elem().Field(f.index)
+	switch v.Interface().(type) {
+	case time.Duration:
+		return v.Interface().(time.Duration).String()
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+func (f field) set(c *Config, raw string) error {
+	v := reflect.ValueOf(c).Elem().Field(f.index)
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(raw)
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", f.key, raw)
+		}
+		v.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", f.key, raw)
+		}
+		v.SetInt(int64(n))
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration", f.key, raw)
+		}
+		v.SetInt(int64(d))
+	default:
+		return fmt.Errorf("%s: unsupported field type %s", f.key, v.Type())
+	}
+	return nil
+}
+
+func apply(c *Config, fields []field, values map[string]string) error {
+	var errs []error
+	for _, f := range fields {
+		raw, ok := values[f.key]
+		if !ok {
+			continue
+		}
+		if err := f.set(c, raw); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func envValues(fields []field, lookup func(string) (string, bool)) map[string]string {
+	values := map[string]string{}
+	for _, f := range fields {
+		if v, ok := lookup(strings.ToUpper(f.key)); ok {
+			values[f.key] = v
+		}
+	}
+	return values
+}
+
+// readConfigFile decodes a flat YAML or TOML document, chosen by extension,
+// and rejects keys that do not name a config field.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	raw := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported extension %q, want .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	known := map[string]bool{}
+	for _, f := range configFields() {
+		known[f.key] = true
+	}
+	values := map[string]string{}
+	for key, v := range raw {
+		if !known[key] {
+			return nil, fmt.Errorf("config file %s: unknown key %q", path, key)
+		}
+		switch v.(type) {
+		case map[string]any, []any:
+			return nil, fmt.Errorf("config file %s: %s must be a scalar", path, key)
+		}
+		values[key] = fmt.Sprint(v)
+	}
+	return values, nil
+}
@@ -0,0 +1,81 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+// source: access_tokens.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const bumpTokenVersion = `-- name: BumpTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = $1
+RETURNING token_version
+`
+
+func (q *Queries) BumpTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, bumpTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
+const getAccessTokenRevocation = `-- name: GetAccessTokenRevocation :one
+SELECT
+	users.token_version,
+	EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = $2) AS revoked
+FROM users
+WHERE users.id = $1
+`
+
+type GetAccessTokenRevocationParams struct {
+	ID  uuid.UUID
+	Jti string
+}
+
+type GetAccessTokenRevocationRow struct {
+	TokenVersion int32
+	Revoked      bool
+}
+
+func (q *Queries) GetAccessTokenRevocation(ctx context.Context, arg GetAccessTokenRevocationParams) (GetAccessTokenRevocationRow, error) {
+	row := q.db.QueryRowContext(ctx, getAccessTokenRevocation, arg.ID, arg.Jti)
+	var i GetAccessTokenRevocationRow
+	err := row.Scan(&i.TokenVersion, &i.Revoked)
+	return i, err
+}
+
+const pruneRevokedAccessTokens = `-- name: PruneRevokedAccessTokens :execrows
+DELETE FROM revoked_access_tokens
+WHERE expires_at < $1
+`
+
+func (q *Queries) PruneRevokedAccessTokens(ctx context.Context, expiresAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pruneRevokedAccessTokens, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeAccessToken = `-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (jti) DO NOTHING
+`
+
+type RevokeAccessTokenParams struct {
+	Jti       string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) error {
+	_, err := q.db.ExecContext(ctx, revokeAccessToken, arg.Jti, arg.ExpiresAt)
+	return err
+}
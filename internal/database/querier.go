@@ -0,0 +1,46 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.28.0
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Querier interface {
+	BumpTokenVersion(ctx context.Context, id uuid.UUID) (int32, error)
+	CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error)
+	CreatePersonalAccessToken(ctx context.Context, arg CreatePersonalAccessTokenParams) (PersonalAccessToken, error)
+	CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error)
+	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	DeleteChirp(ctx context.Context, arg DeleteChirpParams) error
+	GetAccessTokenRevocation(ctx context.Context, arg GetAccessTokenRevocationParams) (GetAccessTokenRevocationRow, error)
+	GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error)
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (PersonalAccessToken, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+	GetUser(ctx context.Context, id uuid.UUID) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error)
+	ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error)
+	ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]PersonalAccessToken, error)
+	LockUser(ctx context.Context, arg LockUserParams) error
+	PruneRevokedAccessTokens(ctx context.Context, expiresAt time.Time) (int64, error)
+	RecordFailedLogin(ctx context.Context, id uuid.UUID) (int32, error)
+	Reset(ctx context.Context) error
+	ResetLoginFailures(ctx context.Context, id uuid.UUID) (User, error)
+	RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) error
+	RevokeAllPersonalAccessTokensForUser(ctx context.Context, arg RevokeAllPersonalAccessTokensForUserParams) error
+	RevokeAllRefreshTokensForUser(ctx context.Context, arg RevokeAllRefreshTokensForUserParams) error
+	RevokePersonalAccessToken(ctx context.Context, arg RevokePersonalAccessTokenParams) (int64, error)
+	RevokeRefreshToken(ctx context.Context, arg RevokeRefreshTokenParams) (RefreshToken, error)
+	TouchPersonalAccessToken(ctx context.Context, arg TouchPersonalAccessTokenParams) error
+	UpdatePasswordHash(ctx context.Context, arg UpdatePasswordHashParams) error
+	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	UpgradeUserToChirpyRed(ctx context.Context, arg UpgradeUserToChirpyRedParams) (User, error)
+}
+
+var _ Querier = (*Queries)(nil)
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,7 +22,7 @@ VALUES (
 	$4,
 	$5
 )
-RETURNING id, created_at, updated_at, email, hashed_password
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, failed_login_attempts, locked_until, token_version
 `
 
 type CreateUserParams struct {
@@ -47,12 +48,17 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, email, hashed_password FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, failed_login_attempts, locked_until, token_version FROM users
 WHERE id = $1
 `
 
@@ -65,12 +71,17 @@ func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, failed_login_attempts, locked_until, token_version FROM users
 WHERE email = $1
 `
 
@@ -83,10 +94,45 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
 	)
 	return i, err
 }
 
+const lockUser = `-- name: LockUser :exec
+UPDATE users
+SET locked_until = $2
+WHERE id = $1
+`
+
+type LockUserParams struct {
+	ID          uuid.UUID
+	LockedUntil sql.NullTime
+}
+
+func (q *Queries) LockUser(ctx context.Context, arg LockUserParams) error {
+	_, err := q.db.ExecContext(ctx, lockUser, arg.ID, arg.LockedUntil)
+	return err
+}
+
+const recordFailedLogin = `-- name: RecordFailedLogin :one
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1
+WHERE id = $1
+RETURNING failed_login_attempts
+`
+
+func (q *Queries) RecordFailedLogin(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, recordFailedLogin, id)
+	var failed_login_attempts int32
+	err := row.Scan(&failed_login_attempts)
+	return failed_login_attempts, err
+}
+
 const reset = `-- name: Reset :exec
 TRUNCATE TABLE users CASCADE
 `
@@ -95,3 +141,111 @@ func (q *Queries) Reset(ctx context.Context) error {
 	_, err := q.db.ExecContext(ctx, reset)
 	return err
 }
+
+const resetLoginFailures = `-- name: ResetLoginFailures :one
+UPDATE users
+SET failed_login_attempts = 0, locked_until = NULL
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, failed_login_attempts, locked_until, token_version
+`
+
+func (q *Queries) ResetLoginFailures(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, resetLoginFailures, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+	)
+	return i, err
+}
+
+const updatePasswordHash = `-- name: UpdatePasswordHash :exec
+UPDATE users
+SET hashed_password = $2
+WHERE id = $1
+`
+
+type UpdatePasswordHashParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdatePasswordHash(ctx context.Context, arg UpdatePasswordHashParams) error {
+	_, err := q.db.ExecContext(ctx, updatePasswordHash, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET email = $2, hashed_password = $3, updated_at = $4
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, failed_login_attempts, locked_until, token_version
+`
+
+type UpdateUserParams struct {
+	ID             uuid.UUID
+	Email          string
+	HashedPassword string
+	UpdatedAt      time.Time
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.ID,
+		arg.Email,
+		arg.HashedPassword,
+		arg.UpdatedAt,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+	)
+	return i, err
+}
+
+const upgradeUserToChirpyRed = `-- name: UpgradeUserToChirpyRed :one
+UPDATE users
+SET is_chirpy_red = TRUE, updated_at = $2
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, failed_login_attempts, locked_until, token_version
+`
+
+type UpgradeUserToChirpyRedParams struct {
+	ID        uuid.UUID
+	UpdatedAt time.Time
+}
+
+func (q *Queries) UpgradeUserToChirpyRed(ctx context.Context, arg UpgradeUserToChirpyRedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, upgradeUserToChirpyRed, arg.ID, arg.UpdatedAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.IsAdmin,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.TokenVersion,
+	)
+	return i, err
+}
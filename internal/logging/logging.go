@@ -0,0 +1,164 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jdwalkerzhere/httpServer/internal/httpx"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// New builds a logger writing to w. level is one of debug, info, warn or
+// error; format is text or json.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log level %q: %w", level, err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("log format must be \"text\" or \"json\", got %q", format)
+	}
+}
+
+type contextKey struct{}
+
+// requestLog collects what handlers learn about a request while serving
+// it, so the middleware can put it on the access log record.
+type requestLog struct {
+	id     string
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	userID string
+	err    error
+	attrs  []slog.Attr
+}
+
+// Middleware assigns every request an ID, taken from the X-Request-ID
+// header when the client sent a usable one, echoes it on the response and
+// writes one access log record when the request completes.
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		rl := &requestLog{id: id, logger: logger.With(slog.String("request_id", id))}
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, rl))
+		rec := httpx.NewResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		// ServeMux records the matched pattern on the request it was given.
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.Status),
+			slog.Int("bytes", rec.Bytes),
+			slog.Duration("latency", time.Since(start)),
+		}
+
+		rl.mu.Lock()
+		if rl.userID != "" {
+			attrs = append(attrs, slog.String("user_id", rl.userID))
+		}
+		if rl.err != nil {
+			attrs = append(attrs, slog.String("error", rl.err.Error()))
+		}
+		attrs = append(attrs, rl.attrs...)
+		rl.mu.Unlock()
+
+		level := slog.LevelInfo
+		switch {
+		case rec.Status >= 500:
+			level = slog.LevelError
+		case rec.Status >= 400:
+			level = slog.LevelWarn
+		}
+		rl.logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	return !strings.ContainsFunc(id, func(r rune) bool {
+		return r < 0x21 || r > 0x7e
+	})
+}
+
+func fromContext(ctx context.Context) *requestLog {
+	rl, _ := ctx.Value(contextKey{}).(*requestLog)
+	return rl
+}
+
+// RequestID returns the ID Middleware assigned to the request, or "" outside
+// of one.
+func RequestID(ctx context.Context) string {
+	if rl := fromContext(ctx); rl != nil {
+		return rl.id
+	}
+	return ""
+}
+
+// Logger returns a logger tagged with the request ID, falling back to the
+// default logger outside of a request.
+func Logger(ctx context.Context) *slog.Logger {
+	if rl := fromContext(ctx); rl != nil {
+		return rl.logger
+	}
+	return slog.Default()
+}
+
+// SetUserID records the authenticated user on the request's access log.
+func SetUserID(ctx context.Context, userID string) {
+	if rl := fromContext(ctx); rl != nil {
+		rl.mu.Lock()
+		rl.userID = userID
+		rl.mu.Unlock()
+	}
+}
+
+// SetError attaches the underlying cause of a failed request to its access
+// log record. It is never shown to the client.
+func SetError(ctx context.Context, err error) {
+	if rl := fromContext(ctx); rl != nil {
+		rl.mu.Lock()
+		rl.err = err
+		rl.mu.Unlock()
+	}
+}
+
+// AddAttrs attaches extra attributes to the request's access log record.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if rl := fromContext(ctx); rl != nil {
+		rl.mu.Lock()
+		rl.attrs = append(rl.attrs, attrs...)
+		rl.mu.Unlock()
+	}
+}
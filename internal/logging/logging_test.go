@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serve(t *testing.T, req *http.Request) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		SetUserID(r.Context(), "user-1")
+		SetError(r.Context(), errors.New("pq: connection refused"))
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"Error Saving Chirp"}`))
+	})
+	rec := httptest.NewRecorder()
+	Middleware(logger, mux).ServeHTTP(rec, req)
+
+	record := map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected one JSON log record, got %q: %v", buf.String(), err)
+	}
+	return rec, record
+}
+
+func TestMiddlewareLogsRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps/123", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+
+	rec, record := serve(t, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("Expected request ID to be propagated, got: %q", got)
+	}
+	want := map[string]any{
+		"level":      "ERROR",
+		"request_id": "abc-123",
+		"method":     "POST",
+		"route":      "POST /api/chirps/{chirpID}",
+		"status":     float64(500),
+		"bytes":      float64(len(`{"error":"Error Saving Chirp"}`)),
+		"user_id":    "user-1",
+		"error":      "pq: connection refused",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("Expected %s to be %v, got: %v", key, value, record[key])
+		}
+	}
+	if rec.Body.String() != `{"error":"Error Saving Chirp"}` {
+		t.Errorf("Expected error cause to stay out of the response, got: %s", rec.Body.String())
+	}
+}
+
+func TestMiddlewareGeneratesRequestID(t *testing.T) {
+	for name, header := range map[string]string{
+		"missing":     "",
+		"too long":    string(bytes.Repeat([]byte("a"), maxRequestIDLength+1)),
+		"unprintable": "abc\x00def",
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/nowhere", nil)
+			if header != "" {
+				req.Header.Set(RequestIDHeader, header)
+			}
+
+			rec, record := serve(t, req)
+
+			id := rec.Header().Get(RequestIDHeader)
+			if id == "" || id == header {
+				t.Errorf("Expected a freshly generated request ID, got: %q", id)
+			}
+			if record["request_id"] != id {
+				t.Errorf("Expected log record to carry %q, got: %v", id, record["request_id"])
+			}
+			if record["route"] != "unmatched" {
+				t.Errorf("Expected route to be unmatched, got: %v", record["route"])
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jdwalkerzhere/httpServer/internal/httpx"
+)
+
+// HTTPMetrics instruments handlers with request counts, latencies and an
+// in-flight gauge, labeled by the route pattern they were registered under.
+type HTTPMetrics struct {
+	Requests *CounterVec
+	Duration *HistogramVec
+	InFlight *Gauge
+}
+
+func NewHTTPMetrics(r *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		Requests: r.NewCounterVec("chirpy_http_requests_total", "HTTP requests handled, by route and status code.", "route", "code"),
+		Duration: r.NewHistogramVec("chirpy_http_request_duration_seconds", "HTTP request latency, by route.", DefaultBuckets, "route"),
+		InFlight: r.NewGauge("chirpy_http_requests_in_flight", "HTTP requests currently being served."),
+	}
+}
+
+// Instrument wraps next so every request it serves is recorded under route.
+func (m *HTTPMetrics) Instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.InFlight.Inc()
+		defer m.InFlight.Dec()
+
+		start := time.Now()
+		rec := httpx.NewResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		m.Duration.Observe(time.Since(start).Seconds(), route)
+		m.Requests.Inc(route, strconv.Itoa(rec.Status))
+	})
+}
+
+// RegisterDBStats exposes the connection pool statistics of db.
+func RegisterDBStats(r *Registry, db *sql.DB) {
+	r.NewGaugeFunc("chirpy_db_max_open_connections", "Maximum number of open connections to the database.", func() float64 {
+		return float64(db.Stats().MaxOpenConnections)
+	})
+	r.NewGaugeFunc("chirpy_db_open_connections", "Established connections, both in use and idle.", func() float64 {
+		return float64(db.Stats().OpenConnections)
+	})
+	r.NewGaugeFunc("chirpy_db_in_use_connections", "Connections currently in use.", func() float64 {
+		return float64(db.Stats().InUse)
+	})
+	r.NewGaugeFunc("chirpy_db_idle_connections", "Idle connections.", func() float64 {
+		return float64(db.Stats().Idle)
+	})
+	r.NewCounterFunc("chirpy_db_wait_count_total", "Connections waited for.", func() float64 {
+		return float64(db.Stats().WaitCount)
+	})
+	r.NewCounterFunc("chirpy_db_wait_duration_seconds_total", "Time spent waiting for a connection.", func() float64 {
+		return db.Stats().WaitDuration.Seconds()
+	})
+}
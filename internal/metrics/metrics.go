@@ -0,0 +1,335 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are latency buckets in seconds suited to an HTTP API.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is anything the registry can render in the Prometheus text
+// exposition format.
+type collector interface {
+	describe() (name, help, kind string)
+	write(w io.Writer)
+}
+
+// Registry holds every metric the server exposes and renders them in
+// registration order.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name, _, _ := c.describe()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText renders every registered metric in the Prometheus text
+// exposition format (version 0.0.4).
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		name, help, kind := c.describe()
+		fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+		c.write(w)
+	}
+}
+
+// Handler serves the registry for a Prometheus scraper.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		r.WriteText(w)
+	})
+}
+
+// Counter is a monotonically increasing count.
+type Counter struct {
+	name, help string
+	value      atomic.Uint64
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	r.register(c)
+	return c
+}
+
+func (c *Counter) Inc()          { c.value.Add(1) }
+func (c *Counter) Add(n uint64)  { c.value.Add(n) }
+func (c *Counter) Value() uint64 { return c.value.Load() }
+func (c *Counter) Reset()        { c.value.Store(0) }
+func (c *Counter) describe() (string, string, string) {
+	return c.name, c.help, "counter"
+}
+func (c *Counter) write(w io.Writer) {
+	fmt.Fprintf(w, "%s %d\n", c.name, c.Value())
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	name, help string
+	value      atomic.Int64
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	r.register(g)
+	return g
+}
+
+func (g *Gauge) Inc()         { g.value.Add(1) }
+func (g *Gauge) Dec()         { g.value.Add(-1) }
+func (g *Gauge) Set(v int64)  { g.value.Store(v) }
+func (g *Gauge) Value() int64 { return g.value.Load() }
+func (g *Gauge) describe() (string, string, string) {
+	return g.name, g.help, "gauge"
+}
+func (g *Gauge) write(w io.Writer) {
+	fmt.Fprintf(w, "%s %d\n", g.name, g.Value())
+}
+
+// valueFunc is a gauge or counter whose value is read at scrape time.
+type valueFunc struct {
+	name, help, kind string
+	fn               func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by fn on every
+// scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&valueFunc{name: name, help: help, kind: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is computed by fn on every
+// scrape. fn must never decrease.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&valueFunc{name: name, help: help, kind: "counter", fn: fn})
+}
+
+func (v *valueFunc) describe() (string, string, string) {
+	return v.name, v.help, v.kind
+}
+func (v *valueFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "%s %s\n", v.name, formatFloat(v.fn()))
+}
+
+// CounterVec is a family of counters partitioned by label values.
+type CounterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]*labeledCounter
+}
+
+type labeledCounter struct {
+	values []string
+	value  atomic.Uint64
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, series: map[string]*labeledCounter{}}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter identified by values, which must match the
+// vector's labels in number and order.
+func (c *CounterVec) Inc(values ...string) {
+	c.get(values).value.Add(1)
+}
+
+func (c *CounterVec) get(values []string) *labeledCounter {
+	if len(values) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", c.name, len(c.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &labeledCounter{values: append([]string(nil), values...)}
+		c.series[key] = s
+	}
+	return s
+}
+
+// Sample is one labeled value of a vector.
+type Sample struct {
+	Labels map[string]string
+	Value  uint64
+}
+
+// Snapshot returns the current value of every series, sorted by label
+// values.
+func (c *CounterVec) Snapshot() []Sample {
+	c.mu.Lock()
+	series := make([]*labeledCounter, 0, len(c.series))
+	for _, s := range c.series {
+		series = append(series, s)
+	}
+	c.mu.Unlock()
+	sort.Slice(series, func(i, j int) bool {
+		return strings.Join(series[i].values, "\xff") < strings.Join(series[j].values, "\xff")
+	})
+
+	samples := make([]Sample, 0, len(series))
+	for _, s := range series {
+		labels := map[string]string{}
+		for i, name := range c.labels {
+			labels[name] = s.values[i]
+		}
+		samples = append(samples, Sample{Labels: labels, Value: s.value.Load()})
+	}
+	return samples
+}
+
+func (c *CounterVec) describe() (string, string, string) {
+	return c.name, c.help, "counter"
+}
+func (c *CounterVec) write(w io.Writer) {
+	for _, s := range c.Snapshot() {
+		fmt.Fprintf(w, "%s%s %d\n", c.name, formatLabels(c.labels, s.Labels, "", ""), s.Value)
+	}
+}
+
+// HistogramVec is a family of histograms partitioned by label values.
+type HistogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	values []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: append([]float64(nil), buckets...),
+		series:  map[string]*histogram{},
+	}
+	sort.Float64s(h.buckets)
+	r.register(h)
+	return h
+}
+
+// Observe records v in the histogram identified by values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	if len(values) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", h.name, len(h.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{values: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) describe() (string, string, string) {
+	return h.name, h.help, "histogram"
+}
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		labels := map[string]string{}
+		for i, name := range h.labels {
+			labels[name] = s.values[i]
+		}
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, labels, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, labels, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, labels, "", ""), s.count)
+	}
+}
+
+func formatLabels(names []string, values map[string]string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabel(values[name])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraName, extraValue))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	reg := NewRegistry()
+	hits := reg.NewCounter("hits_total", "Total hits.")
+	requests := reg.NewCounterVec("requests_total", "Requests by route.", "route", "code")
+	latency := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	reg.NewGaugeFunc("answer", "The answer.", func() float64 { return 42 })
+
+	hits.Add(3)
+	requests.Inc("GET /b", "200")
+	requests.Inc("GET /a", "404")
+	requests.Inc("GET /a", "404")
+	requests.Inc(`GET /"q"`, "200")
+	latency.Observe(0.05, "GET /a")
+	latency.Observe(0.5, "GET /a")
+	latency.Observe(3, "GET /a")
+
+	var b strings.Builder
+	reg.WriteText(&b)
+
+	want := `# HELP hits_total Total hits.
+# TYPE hits_total counter
+hits_total 3
+# HELP requests_total Requests by route.
+# TYPE requests_total counter
+requests_total{route="GET /\"q\"",code="200"} 1
+requests_total{route="GET /a",code="404"} 2
+requests_total{route="GET /b",code="200"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="GET /a",le="0.1"} 1
+latency_seconds_bucket{route="GET /a",le="1"} 2
+latency_seconds_bucket{route="GET /a",le="+Inf"} 3
+latency_seconds_sum{route="GET /a"} 3.55
+latency_seconds_count{route="GET /a"} 3
+# HELP answer The answer.
+# TYPE answer gauge
+answer 42
+`
+	if got := b.String(); got != want {
+		t.Errorf("Unexpected exposition output.\nGot:\n%s\nWant:\n%s", got, want)
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	reg := NewRegistry()
+	m := NewHTTPMetrics(reg)
+	handler := m.Instrument("GET /teapot", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.InFlight.Value() != 1 {
+			t.Errorf("Expected 1 request in flight, got: %d", m.InFlight.Value())
+		}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/teapot", nil))
+
+	samples := m.Requests.Snapshot()
+	if len(samples) != 1 || samples[0].Labels["code"] != "418" || samples[0].Value != 1 {
+		t.Errorf("Expected one 418 sample, got: %+v", samples)
+	}
+	if m.InFlight.Value() != 0 {
+		t.Errorf("Expected no requests in flight, got: %d", m.InFlight.Value())
+	}
+}
@@ -0,0 +1,114 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jdwalkerzhere/httpServer/sql/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// ErrSchemaOutdated means the database is missing migrations this build
+// depends on.
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// NewProvider returns a goose provider for the embedded migrations. It takes
+// a Postgres advisory lock around every operation so replicas starting at the
+// same time apply each migration exactly once.
+func NewProvider(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, schema.FS, goose.WithSessionLocker(locker))
+}
+
+// Up applies every pending migration.
+func Up(ctx context.Context, db *sql.DB) ([]*goose.MigrationResult, error) {
+	provider, err := NewProvider(db)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Up(ctx)
+}
+
+// Check returns an error wrapping ErrSchemaOutdated if any embedded migration
+// has not been applied. A database that is ahead of this build is accepted,
+// so an older replica keeps serving during a rolling deploy.
+func Check(ctx context.Context, db *sql.DB) error {
+	provider, err := NewProvider(db)
+	if err != nil {
+		return err
+	}
+	pending, err := provider.HasPending(ctx)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if !pending {
+		return nil
+	}
+	current, target, err := provider.GetVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	return fmt.Errorf("%w: at version %d, want %d; run \"chirpy migrate up\" or set auto_migrate", ErrSchemaOutdated, current, target)
+}
+
+// Run executes one migrate subcommand (up, down, status or redo), writing a
+// line per migration to w.
+func Run(ctx context.Context, db *sql.DB, command string, w io.Writer) error {
+	provider, err := NewProvider(db)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		results, err := provider.Up(ctx)
+		printResults(w, results...)
+		if err == nil && len(results) == 0 {
+			fmt.Fprintln(w, "no pending migrations")
+		}
+		return err
+	case "down":
+		result, err := provider.Down(ctx)
+		printResults(w, result)
+		return err
+	case "redo":
+		result, err := provider.Down(ctx)
+		printResults(w, result)
+		if err != nil {
+			return err
+		}
+		result, err = provider.UpByOne(ctx)
+		printResults(w, result)
+		return err
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.State == goose.StateApplied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%-19s %s\n", appliedAt, s.Source.Path)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, want up, down, status or redo", command)
+	}
+}
+
+func printResults(w io.Writer, results ...*goose.MigrationResult) {
+	for _, r := range results {
+		if r != nil {
+			fmt.Fprintln(w, r)
+		}
+	}
+}
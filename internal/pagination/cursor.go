@@ -0,0 +1,70 @@
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a keyset position: the (created_at, id) of the last row a client
+// has already seen.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// DeriveKey returns the key to sign cursors with, derived from secret so the
+// secret itself is never used for more than one purpose.
+func DeriveKey(secret string) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte("chirpy pagination cursor key"))
+	return h.Sum(nil)
+}
+
+// Encode serializes c into an opaque, URL-safe string signed with key so
+// clients cannot forge positions. The signature also covers query, the sort
+// order and filters the position was read under, so a cursor only decodes
+// for the same query.
+func Encode(c Cursor, query string, key []byte) string {
+	payload := make([]byte, 8, 8+len(c.ID))
+	binary.BigEndian.PutUint64(payload, uint64(c.CreatedAt.UnixNano()))
+	payload = append(payload, c.ID[:]...)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sign(payload, query, key))
+}
+
+// Decode verifies and parses a cursor produced by Encode for query.
+func Decode(s, query string, key []byte) (Cursor, error) {
+	encPayload, encMAC, ok := strings.Cut(s, ".")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encPayload)
+	if err != nil || len(payload) != 8+len(uuid.UUID{}) {
+		return Cursor{}, ErrInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encMAC)
+	if err != nil || !hmac.Equal(mac, sign(payload, query, key)) {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	c := Cursor{CreatedAt: time.Unix(0, int64(binary.BigEndian.Uint64(payload[:8]))).UTC()}
+	copy(c.ID[:], payload[8:])
+	return c, nil
+}
+
+func sign(payload []byte, query string, key []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte("chirpy-cursor-v2:"))
+	binary.Write(h, binary.BigEndian, uint32(len(query)))
+	h.Write([]byte(query))
+	h.Write(payload)
+	return h.Sum(nil)
+}
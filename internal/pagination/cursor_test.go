@@ -0,0 +1,63 @@
+package pagination
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	key := []byte("test-secret-key")
+	want := Cursor{
+		CreatedAt: time.Date(2025, 3, 14, 15, 9, 26, 535897000, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	got, err := Decode(Encode(want, "sort=desc", key), "sort=desc", key)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Errorf("Expected %+v, got: %+v", want, got)
+	}
+}
+
+func TestDecodeRejectsTampering(t *testing.T) {
+	key := []byte("test-secret-key")
+	encoded := Encode(Cursor{CreatedAt: time.Now(), ID: uuid.New()}, "sort=asc", key)
+	payload, mac, _ := strings.Cut(encoded, ".")
+
+	tests := map[string]struct {
+		cursor string
+		query  string
+		key    []byte
+	}{
+		"wrong key":        {encoded, "sort=asc", []byte("wrong-secret-key")},
+		"other query":      {encoded, "sort=desc", key},
+		"modified payload": {"A" + payload[1:] + "." + mac, "sort=asc", key},
+		"missing mac":      {payload, "sort=asc", key},
+		"not base64":       {"!!!." + mac, "sort=asc", key},
+		"empty":            {"", "sort=asc", key},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decode(tc.cursor, tc.query, tc.key); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("Expected ErrInvalidCursor, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	key := DeriveKey("test-secret-key")
+	if string(key) == "test-secret-key" || len(key) != sha256.Size {
+		t.Errorf("Expected a derived 32 byte key, got: %x", key)
+	}
+	if string(DeriveKey("test-secret-key")) != string(key) {
+		t.Error("Expected the same secret to derive the same key")
+	}
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jdwalkerzhere/httpServer/internal/logging"
+	"github.com/jdwalkerzhere/httpServer/internal/response"
+)
+
+// DefaultRoute is the policy key that applies to routes without their own
+// policy.
+const DefaultRoute = "*"
+
+// Policy is a token bucket: it holds up to Limit tokens and refills at
+// Limit tokens per Window, so a client can burst Limit requests and then
+// sustain Limit per Window.
+type Policy struct {
+	Limit  int
+	Window time.Duration
+}
+
+// interval is how long the bucket takes to regain one token.
+func (p Policy) interval() time.Duration {
+	return p.Window / time.Duration(p.Limit)
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until a token is available; zero if Allowed.
+	RetryAfter time.Duration
+}
+
+// Backend stores buckets. Implementations must be safe for concurrent use;
+// a shared backend lets several replicas enforce one limit.
+type Backend interface {
+	Take(ctx context.Context, key string, p Policy, now time.Time) (Result, error)
+}
+
+// KeyFunc identifies the client a request is charged to.
+type KeyFunc func(r *http.Request) string
+
+// Limiter applies per-route policies to requests.
+type Limiter struct {
+	backend  Backend
+	policies map[string]Policy
+	key      KeyFunc
+	now      func() time.Time
+}
+
+func New(backend Backend, policies map[string]Policy, key KeyFunc) *Limiter {
+	return &Limiter{backend: backend, policies: policies, key: key, now: time.Now}
+}
+
+// Middleware limits requests to route by the route's policy, or the
+// DefaultRoute policy if it has none. Without either, next is returned as is.
+// Allowed responses carry RateLimit-* headers; rejected ones get a 429 with
+// Retry-After. If the backend fails the request is let through.
+func (l *Limiter) Middleware(route string, next http.Handler) http.Handler {
+	policy, ok := l.policies[route]
+	if !ok {
+		policy, ok = l.policies[DefaultRoute]
+	}
+	if !ok {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := l.backend.Take(r.Context(), route+"|"+l.key(r), policy, l.now())
+		if err != nil {
+			logging.AddAttrs(r.Context(), slog.String("rate_limit_error", err.Error()))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, seconds(policy.Window)))
+		h.Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+		if !result.Allowed {
+			h.Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+			response.WriteError(w, r, response.Error{
+				Status:  http.StatusTooManyRequests,
+				Code:    response.CodeRateLimited,
+				Message: "Too many requests, slow down",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// seconds rounds d up to whole seconds, as the headers require.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIP returns the host part of the request's remote address. Proxy
+// headers are ignored since any client can set them.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ParsePolicies reads policies written as "<route>=<limit>/<window>"
+// separated by semicolons, e.g. "POST /api/login=10/1m; *=600/1m". Routes
+// are ServeMux patterns, or "*" for the default.
+func ParsePolicies(s string) (map[string]Policy, error) {
+	policies := map[string]Policy{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, rate, ok := strings.Cut(entry, "=")
+		route = strings.TrimSpace(route)
+		if !ok || route == "" {
+			return nil, fmt.Errorf("rate limit %q: want <route>=<limit>/<window>", entry)
+		}
+		limit, window, ok := strings.Cut(strings.TrimSpace(rate), "/")
+		if !ok {
+			return nil, fmt.Errorf("rate limit %q: want <limit>/<window>", entry)
+		}
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("rate limit %q: limit must be a positive integer", entry)
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("rate limit %q: window must be a positive duration", entry)
+		}
+		if _, dup := policies[route]; dup {
+			return nil, fmt.Errorf("rate limit for %q is set twice", route)
+		}
+		policies[route] = Policy{Limit: n, Window: d}
+	}
+	return policies, nil
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryTokenBucket(t *testing.T) {
+	m := NewMemory()
+	p := Policy{Limit: 3, Window: 3 * time.Second}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 2; i >= 0; i-- {
+		result, _ := m.Take(context.Background(), "k", p, now)
+		if !result.Allowed || result.Remaining != i {
+			t.Fatalf("Expected burst request to be allowed with %d remaining, got: %+v", i, result)
+		}
+	}
+	result, _ := m.Take(context.Background(), "k", p, now)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Fatalf("Expected empty bucket to refuse with a 1s retry, got: %+v", result)
+	}
+
+	if result, _ := m.Take(context.Background(), "other", p, now); !result.Allowed {
+		t.Error("Expected buckets to be independent per key")
+	}
+
+	result, _ = m.Take(context.Background(), "k", p, now.Add(time.Second))
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected one token to refill after 1s, got: %+v", result)
+	}
+	result, _ = m.Take(context.Background(), "k", p, now.Add(time.Hour))
+	if !result.Allowed || result.Remaining != 2 {
+		t.Errorf("Expected the bucket to refill only up to its limit, got: %+v", result)
+	}
+}
+
+func TestMemorySweepsFullBuckets(t *testing.T) {
+	m := NewMemory()
+	p := Policy{Limit: 1, Window: time.Second}
+	now := time.Now()
+	m.Take(context.Background(), "k", p, now)
+
+	m.Take(context.Background(), "other", p, now.Add(2*sweepInterval))
+
+	if _, ok := m.buckets["k"]; ok {
+		t.Error("Expected the refilled bucket to be swept")
+	}
+}
+
+type failingBackend struct{}
+
+func (failingBackend) Take(context.Context, string, Policy, time.Time) (Result, error) {
+	return Result{}, errors.New("backend down")
+}
+
+func TestMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	policies := map[string]Policy{"POST /api/login": {Limit: 1, Window: time.Minute}}
+	l := New(NewMemory(), policies, ClientIP)
+	h := l.Middleware("POST /api/login", ok)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected first request through, got: %d", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"RateLimit-Policy":    "1;w=60",
+		"RateLimit-Limit":     "1",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("Expected %s %q, got: %q", header, want, got)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("Expected 429 with Retry-After 60, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	body := map[string]string{}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if body["code"] != "rate_limited" {
+		t.Errorf("Expected rate_limited error code, got: %s", rec.Body.String())
+	}
+
+	other := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	other.RemoteAddr = "198.51.100.7:4321"
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, other)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected another client to have its own bucket, got: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	l.Middleware("GET /api/chirps", ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/chirps", nil))
+	if rec.Header().Get("RateLimit-Limit") != "" {
+		t.Error("Expected routes without a policy to be left alone")
+	}
+
+	rec = httptest.NewRecorder()
+	New(failingBackend{}, policies, ClientIP).Middleware("POST /api/login", ok).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected requests through when the backend fails, got: %d", rec.Code)
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies("POST /api/login=10/1m; *=600/1m ;")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if policies["POST /api/login"] != (Policy{Limit: 10, Window: time.Minute}) || policies[DefaultRoute] != (Policy{Limit: 600, Window: time.Minute}) || len(policies) != 2 {
+		t.Errorf("Unexpected policies: %+v", policies)
+	}
+
+	for input, wantErr := range map[string]string{
+		"POST /api/login":         "want <route>=<limit>/<window>",
+		"POST /api/login=10":      "want <limit>/<window>",
+		"POST /api/login=0/1m":    "limit must be a positive integer",
+		"POST /api/login=10/soon": "window must be a positive duration",
+		"*=1/1s; *=2/1s":          `rate limit for "*" is set twice`,
+		"=1/1s":                   "want <route>=<limit>/<window>",
+		"POST /api/login=10/-1m":  "window must be a positive duration",
+		"POST /api/login=many/1m": "limit must be a positive integer",
+	} {
+		if _, err := ParsePolicies(input); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%q: expected error containing %q, got: %v", input, wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package response
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Machine-readable error codes. Clients should branch on these rather than
+// on the human-readable message.
+const (
+	CodeMalformedRequest   = "malformed_request"
+	CodeValidationFailed   = "validation_failed"
+	CodeUnauthenticated    = "unauthenticated"
+	CodeInvalidToken       = "invalid_token"
+	CodeTokenExpired       = "token_expired"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeForbidden          = "forbidden"
+	CodeInsufficientScope  = "insufficient_scope"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal_error"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Error is an API error response.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+}
+
+// errorBody is the default error representation. "error" carries the
+// message, as it always has.
+type errorBody struct {
+	Message string       `json:"error"`
+	Code    string       `json:"code"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// Problem is an RFC 9457 problem details object, extended with the error
+// code and field errors.
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Code   string       `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// JSON writes payload as the JSON response body with the given status.
+func JSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if payload != nil {
+		json.NewEncoder(w).Encode(payload)
+	}
+}
+
+// WriteError writes e as application/problem+json when the client asks for
+// it in Accept, and as the default {"error": ..., "code": ...} body
+// otherwise.
+func WriteError(w http.ResponseWriter, r *http.Request, e Error) {
+	if !acceptsProblem(r) {
+		JSON(w, e.Status, errorBody{Message: e.Message, Code: e.Code, Fields: e.Fields})
+		return
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(e.Status),
+		Status: e.Status,
+		Detail: e.Message,
+		Code:   e.Code,
+		Errors: e.Fields,
+	})
+}
+
+func acceptsProblem(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mediaType == ProblemContentType && params["q"] != "0" {
+				return true
+			}
+		}
+	}
+	return false
+}
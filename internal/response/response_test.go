@@ -0,0 +1,64 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteError(t *testing.T) {
+	e := Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeValidationFailed,
+		Message: "Chirp is too long",
+		Fields:  []FieldError{{Field: "body", Message: "must be at most 140 characters"}},
+	}
+
+	tests := map[string]struct {
+		accept      string
+		contentType string
+		want        string
+	}{
+		"default": {
+			contentType: "application/json",
+			want:        `{"error":"Chirp is too long","code":"validation_failed","fields":[{"field":"body","message":"must be at most 140 characters"}]}`,
+		},
+		"problem requested": {
+			accept:      "application/json, application/problem+json;q=0.9",
+			contentType: ProblemContentType,
+			want:        `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Chirp is too long","code":"validation_failed","errors":[{"field":"body","message":"must be at most 140 characters"}]}`,
+		},
+		"problem refused": {
+			accept:      "application/problem+json;q=0",
+			contentType: "application/json",
+			want:        `{"error":"Chirp is too long","code":"validation_failed","fields":[{"field":"body","message":"must be at most 140 characters"}]}`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rec := httptest.NewRecorder()
+
+			WriteError(rec, req, e)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got: %d", rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tc.contentType {
+				t.Errorf("Expected Content-Type %q, got: %q", tc.contentType, got)
+			}
+			var got, want any
+			json.Unmarshal(rec.Body.Bytes(), &got)
+			json.Unmarshal([]byte(tc.want), &want)
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("Expected body %s, got: %s", wantJSON, gotJSON)
+			}
+		})
+	}
+}
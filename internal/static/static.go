@@ -0,0 +1,129 @@
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdwalkerzhere/httpServer/internal/response"
+)
+
+const (
+	indexFile = "index.html"
+	assetsDir = "assets/"
+
+	// Assets are cached for a week; index.html is always revalidated, which
+	// its ETag makes cheap, so new deploys are picked up immediately.
+	assetCacheControl = "public, max-age=604800"
+	indexCacheControl = "no-cache"
+)
+
+// Handler serves index.html and the files under assets/ from an fs.FS and
+// nothing else, so configuration and source files next to them can never
+// leak. Dotfiles and directory listings are refused, every response carries
+// an ETag derived from the file's contents, and extensionless paths that do
+// not match a file fall back to index.html so client-side routes work.
+type Handler struct {
+	fsys fs.FS
+
+	mu    sync.Mutex
+	etags map[string]etag
+}
+
+type etag struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+func New(fsys fs.FS) *Handler {
+	return &Handler{fsys: fsys, etags: map[string]etag{}}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = indexFile
+	}
+	if !allowed(name) {
+		notFound(w, r)
+		return
+	}
+
+	data, info, err := h.read(name)
+	if errors.Is(err, fs.ErrNotExist) && !strings.HasPrefix(name, assetsDir) && path.Ext(name) == "" {
+		name = indexFile
+		data, info, err = h.read(name)
+	}
+	if err != nil {
+		notFound(w, r)
+		return
+	}
+
+	if name == indexFile {
+		w.Header().Set("Cache-Control", indexCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", assetCacheControl)
+	}
+	w.Header().Set("ETag", h.etag(name, info, data))
+	http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(data))
+}
+
+// allowed reports whether name may be served at all: index.html, anything
+// under assets/, or a path that could be an SPA route. No path segment may
+// start with a dot.
+func allowed(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+	return name == indexFile || strings.HasPrefix(name, assetsDir) || path.Ext(name) == ""
+}
+
+// read returns a regular file's contents. Directories and anything outside
+// index.html and assets/ report fs.ErrNotExist.
+func (h *Handler) read(name string) ([]byte, fs.FileInfo, error) {
+	if name != indexFile && !strings.HasPrefix(name, assetsDir) {
+		return nil, nil, fs.ErrNotExist
+	}
+	info, err := fs.Stat(h.fsys, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, fs.ErrNotExist
+	}
+	data, err := fs.ReadFile(h.fsys, name)
+	return data, info, err
+}
+
+// etag returns a strong ETag for name's contents, reusing the last hash
+// while the file's size and modification time are unchanged.
+func (h *Handler) etag(name string, info fs.FileInfo, data []byte) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cached, ok := h.etags[name]
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.value
+	}
+	sum := sha256.Sum256(data)
+	value := `"` + hex.EncodeToString(sum[:16]) + `"`
+	h.etags[name] = etag{modTime: info.ModTime(), size: info.Size(), value: value}
+	return value
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	response.WriteError(w, r, response.Error{
+		Status:  http.StatusNotFound,
+		Code:    response.CodeNotFound,
+		Message: "File not found",
+	})
+}
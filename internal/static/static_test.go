@@ -0,0 +1,102 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":          {Data: []byte("<h1>Chirpy</h1>")},
+		"assets/logo.png":     {Data: []byte("png")},
+		"assets/.secret":      {Data: []byte("hidden")},
+		"assets/icons/a.svg":  {Data: []byte("<svg/>")},
+		".env":                {Data: []byte("AUTH_SECRET=hunter2")},
+		"go.mod":              {Data: []byte("module chirpy")},
+		"sql/schema/001.sql":  {Data: []byte("CREATE TABLE users")},
+		"internal/config.txt": {Data: []byte("nope")},
+	}
+}
+
+func TestServesAllowedFiles(t *testing.T) {
+	h := New(testFS())
+	tests := []struct {
+		path         string
+		wantBody     string
+		cacheControl string
+	}{
+		{"/", "<h1>Chirpy</h1>", indexCacheControl},
+		{"/index.html", "<h1>Chirpy</h1>", indexCacheControl},
+		{"/assets/logo.png", "png", assetCacheControl},
+		{"/assets/icons/a.svg", "<svg/>", assetCacheControl},
+		{"/chirps/123", "<h1>Chirpy</h1>", indexCacheControl},
+		{"/sql/schema", "<h1>Chirpy</h1>", indexCacheControl},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != http.StatusOK || rec.Body.String() != tt.wantBody {
+				t.Fatalf("Expected 200 %q, got %d %q", tt.wantBody, rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.cacheControl {
+				t.Errorf("Expected Cache-Control %q, got: %q", tt.cacheControl, got)
+			}
+			if rec.Header().Get("ETag") == "" {
+				t.Error("Expected an ETag")
+			}
+		})
+	}
+}
+
+func TestRefusesEverythingElse(t *testing.T) {
+	h := New(testFS())
+	for _, path := range []string{
+		"/.env",
+		"/go.mod",
+		"/sql/schema/001.sql",
+		"/internal/config.txt",
+		"/assets/.secret",
+		"/assets/icons",
+		"/assets/missing.js",
+		"/../.env",
+		"/assets/../.env",
+		"/%2e%2e/go.mod",
+	} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("Expected 404, got %d %q", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestETagRevalidation(t *testing.T) {
+	fsys := testFS()
+	h := New(fsys)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/assets/logo.png", nil))
+	etag := rec.Header().Get("ETag")
+
+	req := httptest.NewRequest(http.MethodGet, "/assets/logo.png", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching ETag, got: %d", rec.Code)
+	}
+
+	fsys["assets/logo.png"] = &fstest.MapFile{Data: []byte("new png")}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("Expected changed content to get a new ETag, got %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,461 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jdwalkerzhere/httpServer/internal/database"
+	"github.com/jdwalkerzhere/httpServer/internal/store"
+)
+
+// Store keeps everything in process memory. It mirrors the Postgres
+// queries' semantics, including sql.ErrNoRows for missing rows and
+// store.ErrUniqueViolation for duplicate emails, and loses all data on exit.
+type Store struct {
+	mu     sync.RWMutex
+	users  map[uuid.UUID]database.User
+	chirps map[uuid.UUID]database.Chirp
+	// refreshTokens is keyed by token hash.
+	refreshTokens map[string]database.RefreshToken
+	// revokedAccessTokens maps jti to expiry.
+	revokedAccessTokens  map[string]time.Time
+	personalAccessTokens map[uuid.UUID]database.PersonalAccessToken
+}
+
+var _ store.Store = (*Store)(nil)
+
+func New() *Store {
+	s := &Store{}
+	s.reset()
+	return s
+}
+
+func (s *Store) reset() {
+	s.users = map[uuid.UUID]database.User{}
+	s.chirps = map[uuid.UUID]database.Chirp{}
+	s.refreshTokens = map[string]database.RefreshToken{}
+	s.revokedAccessTokens = map[string]time.Time{}
+	s.personalAccessTokens = map[uuid.UUID]database.PersonalAccessToken{}
+}
+
+func (s *Store) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+	return nil
+}
+
+func (s *Store) emailTaken(email string, except uuid.UUID) bool {
+	for _, u := range s.users {
+		if u.Email == email && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[arg.ID]; ok || s.emailTaken(arg.Email, uuid.Nil) {
+		return database.User{}, store.ErrUniqueViolation
+	}
+	u := database.User{
+		ID:             arg.ID,
+		CreatedAt:      arg.CreatedAt,
+		UpdatedAt:      arg.UpdatedAt,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+	}
+	s.users[u.ID] = u
+	return u, nil
+}
+
+func (s *Store) GetUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *Store) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	if s.emailTaken(arg.Email, arg.ID) {
+		return database.User{}, store.ErrUniqueViolation
+	}
+	u.Email = arg.Email
+	u.HashedPassword = arg.HashedPassword
+	u.UpdatedAt = arg.UpdatedAt
+	s.users[u.ID] = u
+	return u, nil
+}
+
+func (s *Store) UpdatePasswordHash(ctx context.Context, arg database.UpdatePasswordHashParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[arg.ID]; ok {
+		u.HashedPassword = arg.HashedPassword
+		s.users[arg.ID] = u
+	}
+	return nil
+}
+
+func (s *Store) UpgradeUserToChirpyRed(ctx context.Context, arg database.UpgradeUserToChirpyRedParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	u.IsChirpyRed = true
+	u.UpdatedAt = arg.UpdatedAt
+	s.users[u.ID] = u
+	return u, nil
+}
+
+func (s *Store) RecordFailedLogin(ctx context.Context, id uuid.UUID) (int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	u.FailedLoginAttempts++
+	s.users[id] = u
+	return u.FailedLoginAttempts, nil
+}
+
+func (s *Store) LockUser(ctx context.Context, arg database.LockUserParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[arg.ID]; ok {
+		u.LockedUntil = arg.LockedUntil
+		s.users[arg.ID] = u
+	}
+	return nil
+}
+
+func (s *Store) RevokeAccessToken(ctx context.Context, arg database.RevokeAccessTokenParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.revokedAccessTokens[arg.Jti]; !ok {
+		s.revokedAccessTokens[arg.Jti] = arg.ExpiresAt
+	}
+	return nil
+}
+
+func (s *Store) GetAccessTokenRevocation(ctx context.Context, arg database.GetAccessTokenRevocationParams) (database.GetAccessTokenRevocationRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[arg.ID]
+	if !ok {
+		return database.GetAccessTokenRevocationRow{}, sql.ErrNoRows
+	}
+	_, revoked := s.revokedAccessTokens[arg.Jti]
+	return database.GetAccessTokenRevocationRow{TokenVersion: u.TokenVersion, Revoked: revoked}, nil
+}
+
+func (s *Store) PruneRevokedAccessTokens(ctx context.Context, expiresAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pruned int64
+	for jti, exp := range s.revokedAccessTokens {
+		if exp.Before(expiresAt) {
+			delete(s.revokedAccessTokens, jti)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+func (s *Store) BumpTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	u.TokenVersion++
+	s.users[id] = u
+	return u.TokenVersion, nil
+}
+
+func (s *Store) ResetLoginFailures(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	u.FailedLoginAttempts = 0
+	u.LockedUntil = sql.NullTime{}
+	s.users[id] = u
+	return u, nil
+}
+
+func (s *Store) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return database.Chirp{}, fmt.Errorf("chirp author %s does not exist", arg.UserID)
+	}
+	if _, ok := s.chirps[arg.ID]; ok {
+		return database.Chirp{}, store.ErrUniqueViolation
+	}
+	c := database.Chirp{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+	}
+	s.chirps[c.ID] = c
+	return c, nil
+}
+
+func (s *Store) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.chirps[id]
+	if !ok || c.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return c, nil
+}
+
+func (s *Store) DeleteChirp(ctx context.Context, arg database.DeleteChirpParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.chirps[arg.ID]
+	if !ok || c.DeletedAt.Valid {
+		return nil
+	}
+	c.DeletedAt = arg.DeletedAt
+	c.UpdatedAt = arg.DeletedAt.Time
+	s.chirps[c.ID] = c
+	return nil
+}
+
+func (s *Store) ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error) {
+	return s.listChirps(arg, false), nil
+}
+
+func (s *Store) ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error) {
+	return s.listChirps(database.ListChirpsAscParams(arg), true), nil
+}
+
+// chirpBefore orders chirps by (created_at, id), as the keyset index does.
+func chirpBefore(a, b database.Chirp) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return bytes.Compare(a.ID[:], b.ID[:]) < 0
+}
+
+func (s *Store) listChirps(arg database.ListChirpsAscParams, desc bool) []database.Chirp {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cursor *database.Chirp
+	if arg.CursorCreatedAt.Valid {
+		cursor = &database.Chirp{CreatedAt: arg.CursorCreatedAt.Time, ID: arg.CursorID.UUID}
+	}
+
+	chirps := []database.Chirp{}
+	for _, c := range s.chirps {
+		switch {
+		case c.DeletedAt.Valid:
+		case arg.AuthorID.Valid && c.UserID != arg.AuthorID.UUID:
+		case arg.Since.Valid && c.CreatedAt.Before(arg.Since.Time):
+		case arg.Until.Valid && c.CreatedAt.After(arg.Until.Time):
+		case cursor != nil && !desc && !chirpBefore(*cursor, c):
+		case cursor != nil && desc && !chirpBefore(c, *cursor):
+		default:
+			chirps = append(chirps, c)
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		if desc {
+			return chirpBefore(chirps[j], chirps[i])
+		}
+		return chirpBefore(chirps[i], chirps[j])
+	})
+	if int(arg.RowLimit) < len(chirps) {
+		chirps = chirps[:arg.RowLimit]
+	}
+	return chirps
+}
+
+// userExists stands in for the foreign keys on user_id.
+func (s *Store) userExists(id uuid.UUID) bool {
+	_, ok := s.users[id]
+	return ok
+}
+
+func (s *Store) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return database.RefreshToken{}, fmt.Errorf("refresh token owner %s does not exist", arg.UserID)
+	}
+	if _, ok := s.refreshTokens[arg.TokenHash]; ok {
+		return database.RefreshToken{}, store.ErrUniqueViolation
+	}
+	t := database.RefreshToken{
+		TokenHash: arg.TokenHash,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	s.refreshTokens[t.TokenHash] = t
+	return t, nil
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.refreshTokens[tokenHash]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, arg database.RevokeRefreshTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.refreshTokens[arg.TokenHash]
+	if !ok || t.RevokedAt.Valid {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	t.RevokedAt = arg.RevokedAt
+	t.UpdatedAt = arg.RevokedAt.Time
+	s.refreshTokens[t.TokenHash] = t
+	return t, nil
+}
+
+func (s *Store) RevokeAllRefreshTokensForUser(ctx context.Context, arg database.RevokeAllRefreshTokensForUserParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.refreshTokens {
+		if t.UserID == arg.UserID && !t.RevokedAt.Valid {
+			t.RevokedAt = arg.RevokedAt
+			t.UpdatedAt = arg.RevokedAt.Time
+			s.refreshTokens[hash] = t
+		}
+	}
+	return nil
+}
+
+func (s *Store) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.userExists(arg.UserID) {
+		return database.PersonalAccessToken{}, fmt.Errorf("personal access token owner %s does not exist", arg.UserID)
+	}
+	for _, t := range s.personalAccessTokens {
+		if t.ID == arg.ID || t.TokenHash == arg.TokenHash {
+			return database.PersonalAccessToken{}, store.ErrUniqueViolation
+		}
+	}
+	t := database.PersonalAccessToken{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    arg.Scopes,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	s.personalAccessTokens[t.ID] = t
+	return t, nil
+}
+
+func (s *Store) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.personalAccessTokens {
+		if t.TokenHash == tokenHash {
+			return t, nil
+		}
+	}
+	return database.PersonalAccessToken{}, sql.ErrNoRows
+}
+
+func (s *Store) ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var tokens []database.PersonalAccessToken
+	for _, t := range s.personalAccessTokens {
+		if t.UserID == userID && !t.RevokedAt.Valid {
+			tokens = append(tokens, t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+		}
+		return bytes.Compare(tokens[i].ID[:], tokens[j].ID[:]) < 0
+	})
+	return tokens, nil
+}
+
+func (s *Store) RevokePersonalAccessToken(ctx context.Context, arg database.RevokePersonalAccessTokenParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.personalAccessTokens[arg.ID]
+	if !ok || t.UserID != arg.UserID || t.RevokedAt.Valid {
+		return 0, nil
+	}
+	t.RevokedAt = arg.RevokedAt
+	s.personalAccessTokens[t.ID] = t
+	return 1, nil
+}
+
+func (s *Store) RevokeAllPersonalAccessTokensForUser(ctx context.Context, arg database.RevokeAllPersonalAccessTokensForUserParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.personalAccessTokens {
+		if t.UserID == arg.UserID && !t.RevokedAt.Valid {
+			t.RevokedAt = arg.RevokedAt
+			s.personalAccessTokens[id] = t
+		}
+	}
+	return nil
+}
+
+func (s *Store) TouchPersonalAccessToken(ctx context.Context, arg database.TouchPersonalAccessTokenParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.personalAccessTokens[arg.ID]; ok {
+		t.LastUsedAt = arg.LastUsedAt
+		s.personalAccessTokens[t.ID] = t
+	}
+	return nil
+}
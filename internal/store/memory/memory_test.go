@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/jdwalkerzhere/httpServer/internal/store"
+	"github.com/jdwalkerzhere/httpServer/internal/store/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return New()
+	})
+}
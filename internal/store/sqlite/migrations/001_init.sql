@@ -0,0 +1,33 @@
+CREATE TABLE users(
+	id TEXT PRIMARY KEY,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	email TEXT NOT NULL,
+	hashed_password TEXT NOT NULL,
+	is_chirpy_red INTEGER NOT NULL DEFAULT 0,
+	is_admin INTEGER NOT NULL DEFAULT 0,
+	UNIQUE(email)
+);
+
+CREATE TABLE chirps(
+	id TEXT PRIMARY KEY,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	body TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	deleted_at INTEGER,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX chirps_created_at_id_idx ON chirps (created_at, id);
+CREATE INDEX chirps_user_id_created_at_id_idx ON chirps (user_id, created_at, id);
+
+CREATE TABLE refresh_tokens(
+	token TEXT PRIMARY KEY,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	user_id TEXT NOT NULL,
+	expires_at INTEGER NOT NULL,
+	revoked_at INTEGER,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+CREATE TABLE revoked_access_tokens(
+	jti TEXT PRIMARY KEY,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX revoked_access_tokens_expires_at_idx ON revoked_access_tokens (expires_at);
+
+ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+CREATE TABLE personal_access_tokens(
+	id TEXT PRIMARY KEY,
+	created_at INTEGER NOT NULL,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	expires_at INTEGER,
+	last_used_at INTEGER,
+	revoked_at INTEGER,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX personal_access_tokens_user_id_idx ON personal_access_tokens (user_id, created_at);
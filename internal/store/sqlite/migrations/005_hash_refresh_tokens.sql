@@ -0,0 +1,2 @@
+UPDATE refresh_tokens SET token = sha256_hex(token);
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
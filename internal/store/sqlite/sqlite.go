@@ -0,0 +1,446 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jdwalkerzhere/httpServer/internal/database"
+	"github.com/jdwalkerzhere/httpServer/internal/store"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+func init() {
+	// sha256_hex lets migrations hash stored tokens the way auth does.
+	sqlite.MustRegisterDeterministicScalarFunction("sha256_hex", 1, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("sha256_hex: want text, got %T", args[0])
+		}
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:]), nil
+	})
+}
+
+// Store runs the API's queries against a SQLite file using a pure-Go
+// driver, so no database server or cgo toolchain is needed. Timestamps are
+// stored as Unix nanoseconds and UUIDs as text.
+type Store struct {
+	db *sql.DB
+}
+
+var _ store.Store = (*Store)(nil)
+
+// Open opens (creating if needed) the database at path and brings its schema
+// up to date. path may be ":memory:" for a throwaway database.
+func Open(ctx context.Context, path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serializes writers and keeps ":memory:" databases
+	// from being created once per connection.
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// DB exposes the underlying pool, e.g. for connection statistics.
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// migrate applies every embedded migration newer than the database's
+// user_version, each in its own transaction.
+func migrate(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for i, file := range files {
+		if i < version {
+			continue
+		}
+		stmts, err := migrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(stmts)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// translate maps SQLite constraint errors onto store.ErrUniqueViolation.
+func translate(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return fmt.Errorf("%w: %v", store.ErrUniqueViolation, err)
+		}
+	}
+	return err
+}
+
+func toUnix(t time.Time) int64 {
+	return t.UnixNano()
+}
+
+func fromUnix(n int64) time.Time {
+	return time.Unix(0, n).UTC()
+}
+
+func toNullUnix(t sql.NullTime) sql.NullInt64 {
+	return sql.NullInt64{Int64: t.Time.UnixNano(), Valid: t.Valid}
+}
+
+func fromNullUnix(n sql.NullInt64) sql.NullTime {
+	if !n.Valid {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: fromUnix(n.Int64), Valid: true}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+const userColumns = "id, created_at, updated_at, email, hashed_password, is_chirpy_red, is_admin, failed_login_attempts, locked_until, token_version"
+
+func scanUser(row scanner) (database.User, error) {
+	var (
+		u                    database.User
+		createdAt, updatedAt int64
+		lockedUntil          sql.NullInt64
+	)
+	err := row.Scan(&u.ID, &createdAt, &updatedAt, &u.Email, &u.HashedPassword, &u.IsChirpyRed, &u.IsAdmin, &u.FailedLoginAttempts, &lockedUntil, &u.TokenVersion)
+	u.CreatedAt, u.UpdatedAt = fromUnix(createdAt), fromUnix(updatedAt)
+	u.LockedUntil = fromNullUnix(lockedUntil)
+	return u, err
+}
+
+const chirpColumns = "id, created_at, updated_at, body, user_id, deleted_at"
+
+func scanChirp(row scanner) (database.Chirp, error) {
+	var (
+		c                    database.Chirp
+		createdAt, updatedAt int64
+		deletedAt            sql.NullInt64
+	)
+	err := row.Scan(&c.ID, &createdAt, &updatedAt, &c.Body, &c.UserID, &deletedAt)
+	c.CreatedAt, c.UpdatedAt, c.DeletedAt = fromUnix(createdAt), fromUnix(updatedAt), fromNullUnix(deletedAt)
+	return c, err
+}
+
+const refreshTokenColumns = "token_hash, created_at, updated_at, user_id, expires_at, revoked_at"
+
+func scanRefreshToken(row scanner) (database.RefreshToken, error) {
+	var (
+		t                               database.RefreshToken
+		createdAt, updatedAt, expiresAt int64
+		revokedAt                       sql.NullInt64
+	)
+	err := row.Scan(&t.TokenHash, &createdAt, &updatedAt, &t.UserID, &expiresAt, &revokedAt)
+	t.CreatedAt, t.UpdatedAt, t.ExpiresAt = fromUnix(createdAt), fromUnix(updatedAt), fromUnix(expiresAt)
+	t.RevokedAt = fromNullUnix(revokedAt)
+	return t, err
+}
+
+const personalAccessTokenColumns = "id, created_at, user_id, name, token_hash, scopes, expires_at, last_used_at, revoked_at"
+
+func scanPersonalAccessToken(row scanner) (database.PersonalAccessToken, error) {
+	var (
+		t                                database.PersonalAccessToken
+		createdAt                        int64
+		expiresAt, lastUsedAt, revokedAt sql.NullInt64
+	)
+	err := row.Scan(&t.ID, &createdAt, &t.UserID, &t.Name, &t.TokenHash, &t.Scopes, &expiresAt, &lastUsedAt, &revokedAt)
+	t.CreatedAt = fromUnix(createdAt)
+	t.ExpiresAt, t.LastUsedAt, t.RevokedAt = fromNullUnix(expiresAt), fromNullUnix(lastUsedAt), fromNullUnix(revokedAt)
+	return t, err
+}
+
+func (s *Store) Reset(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM users")
+	return err
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx,
+		"INSERT INTO users (id, created_at, updated_at, email, hashed_password) VALUES (?, ?, ?, ?, ?) RETURNING "+userColumns,
+		arg.ID, toUnix(arg.CreatedAt), toUnix(arg.UpdatedAt), arg.Email, arg.HashedPassword,
+	))
+	return u, translate(err)
+}
+
+func (s *Store) GetUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = ?", email))
+}
+
+func (s *Store) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx,
+		"UPDATE users SET email = ?, hashed_password = ?, updated_at = ? WHERE id = ? RETURNING "+userColumns,
+		arg.Email, arg.HashedPassword, toUnix(arg.UpdatedAt), arg.ID,
+	))
+	return u, translate(err)
+}
+
+func (s *Store) UpgradeUserToChirpyRed(ctx context.Context, arg database.UpgradeUserToChirpyRedParams) (database.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		"UPDATE users SET is_chirpy_red = 1, updated_at = ? WHERE id = ? RETURNING "+userColumns,
+		toUnix(arg.UpdatedAt), arg.ID,
+	))
+}
+
+func (s *Store) RecordFailedLogin(ctx context.Context, id uuid.UUID) (int32, error) {
+	var attempts int32
+	err := s.db.QueryRowContext(ctx,
+		"UPDATE users SET failed_login_attempts = failed_login_attempts + 1 WHERE id = ? RETURNING failed_login_attempts", id,
+	).Scan(&attempts)
+	return attempts, err
+}
+
+func (s *Store) UpdatePasswordHash(ctx context.Context, arg database.UpdatePasswordHashParams) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET hashed_password = ? WHERE id = ?", arg.HashedPassword, arg.ID)
+	return err
+}
+
+func (s *Store) LockUser(ctx context.Context, arg database.LockUserParams) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET locked_until = ? WHERE id = ?", toNullUnix(arg.LockedUntil), arg.ID)
+	return err
+}
+
+func (s *Store) ResetLoginFailures(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		"UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = ? RETURNING "+userColumns, id,
+	))
+}
+
+func (s *Store) RevokeAccessToken(ctx context.Context, arg database.RevokeAccessTokenParams) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO revoked_access_tokens (jti, expires_at) VALUES (?, ?) ON CONFLICT (jti) DO NOTHING",
+		arg.Jti, toUnix(arg.ExpiresAt),
+	)
+	return err
+}
+
+func (s *Store) GetAccessTokenRevocation(ctx context.Context, arg database.GetAccessTokenRevocationParams) (database.GetAccessTokenRevocationRow, error) {
+	var row database.GetAccessTokenRevocationRow
+	err := s.db.QueryRowContext(ctx,
+		"SELECT token_version, EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = ?) FROM users WHERE id = ?",
+		arg.Jti, arg.ID,
+	).Scan(&row.TokenVersion, &row.Revoked)
+	return row, err
+}
+
+func (s *Store) PruneRevokedAccessTokens(ctx context.Context, expiresAt time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM revoked_access_tokens WHERE expires_at < ?", toUnix(expiresAt))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *Store) BumpTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	var version int32
+	err := s.db.QueryRowContext(ctx,
+		"UPDATE users SET token_version = token_version + 1 WHERE id = ? RETURNING token_version", id,
+	).Scan(&version)
+	return version, err
+}
+
+func (s *Store) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	c, err := scanChirp(s.db.QueryRowContext(ctx,
+		"INSERT INTO chirps (id, created_at, updated_at, body, user_id) VALUES (?, ?, ?, ?, ?) RETURNING "+chirpColumns,
+		arg.ID, toUnix(arg.CreatedAt), toUnix(arg.UpdatedAt), arg.Body, arg.UserID,
+	))
+	return c, translate(err)
+}
+
+func (s *Store) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	return scanChirp(s.db.QueryRowContext(ctx, "SELECT "+chirpColumns+" FROM chirps WHERE id = ? AND deleted_at IS NULL", id))
+}
+
+func (s *Store) DeleteChirp(ctx context.Context, arg database.DeleteChirpParams) error {
+	deletedAt := toNullUnix(arg.DeletedAt)
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE chirps SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL",
+		deletedAt, deletedAt, arg.ID,
+	)
+	return err
+}
+
+const listChirpsFilter = `SELECT ` + chirpColumns + ` FROM chirps
+WHERE deleted_at IS NULL
+	AND (?1 IS NULL OR user_id = ?1)
+	AND (?2 IS NULL OR created_at >= ?2)
+	AND (?3 IS NULL OR created_at <= ?3)
+`
+
+func (s *Store) ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error) {
+	return s.listChirps(ctx, listChirpsFilter+`
+	AND (?4 IS NULL OR (created_at, id) > (?4, ?5))
+ORDER BY created_at ASC, id ASC
+LIMIT ?6`, arg)
+}
+
+func (s *Store) ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error) {
+	return s.listChirps(ctx, listChirpsFilter+`
+	AND (?4 IS NULL OR (created_at, id) < (?4, ?5))
+ORDER BY created_at DESC, id DESC
+LIMIT ?6`, database.ListChirpsAscParams(arg))
+}
+
+func (s *Store) listChirps(ctx context.Context, query string, arg database.ListChirpsAscParams) ([]database.Chirp, error) {
+	rows, err := s.db.QueryContext(ctx, query,
+		arg.AuthorID, toNullUnix(arg.Since), toNullUnix(arg.Until),
+		toNullUnix(arg.CursorCreatedAt), arg.CursorID, arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.Chirp
+	for rows.Next() {
+		c, err := scanChirp(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, c)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	t, err := scanRefreshToken(s.db.QueryRowContext(ctx,
+		"INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at) VALUES (?, ?, ?, ?, ?) RETURNING "+refreshTokenColumns,
+		arg.TokenHash, toUnix(arg.CreatedAt), toUnix(arg.UpdatedAt), arg.UserID, toUnix(arg.ExpiresAt),
+	))
+	return t, translate(err)
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	return scanRefreshToken(s.db.QueryRowContext(ctx, "SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE token_hash = ?", tokenHash))
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, arg database.RevokeRefreshTokenParams) (database.RefreshToken, error) {
+	revokedAt := toNullUnix(arg.RevokedAt)
+	return scanRefreshToken(s.db.QueryRowContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = ?, updated_at = ? WHERE token_hash = ? AND revoked_at IS NULL RETURNING "+refreshTokenColumns,
+		revokedAt, revokedAt, arg.TokenHash,
+	))
+}
+
+func (s *Store) RevokeAllRefreshTokensForUser(ctx context.Context, arg database.RevokeAllRefreshTokensForUserParams) error {
+	revokedAt := toNullUnix(arg.RevokedAt)
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = ?, updated_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		revokedAt, revokedAt, arg.UserID,
+	)
+	return err
+}
+
+func (s *Store) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	t, err := scanPersonalAccessToken(s.db.QueryRowContext(ctx,
+		"INSERT INTO personal_access_tokens (id, created_at, user_id, name, token_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING "+personalAccessTokenColumns,
+		arg.ID, toUnix(arg.CreatedAt), arg.UserID, arg.Name, arg.TokenHash, arg.Scopes, toNullUnix(arg.ExpiresAt),
+	))
+	return t, translate(err)
+}
+
+func (s *Store) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	return scanPersonalAccessToken(s.db.QueryRowContext(ctx,
+		"SELECT "+personalAccessTokenColumns+" FROM personal_access_tokens WHERE token_hash = ?", tokenHash,
+	))
+}
+
+func (s *Store) ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+personalAccessTokenColumns+" FROM personal_access_tokens WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at, id", userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tokens []database.PersonalAccessToken
+	for rows.Next() {
+		t, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *Store) RevokePersonalAccessToken(ctx context.Context, arg database.RevokePersonalAccessTokenParams) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE personal_access_tokens SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		toNullUnix(arg.RevokedAt), arg.ID, arg.UserID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *Store) RevokeAllPersonalAccessTokensForUser(ctx context.Context, arg database.RevokeAllPersonalAccessTokensForUserParams) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE personal_access_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		toNullUnix(arg.RevokedAt), arg.UserID,
+	)
+	return err
+}
+
+func (s *Store) TouchPersonalAccessToken(ctx context.Context, arg database.TouchPersonalAccessTokenParams) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ?",
+		toNullUnix(arg.LastUsedAt), arg.ID,
+	)
+	return err
+}
@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jdwalkerzhere/httpServer/internal/store"
+	"github.com/jdwalkerzhere/httpServer/internal/store/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		s, err := Open(context.Background(), filepath.Join(t.TempDir(), "chirpy.db"))
+		if err != nil {
+			t.Fatalf("Expected no error opening store, got: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestOpenIsIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.db")
+	for i := 0; i < 2; i++ {
+		s, err := Open(context.Background(), path)
+		if err != nil {
+			t.Fatalf("Expected no error opening store (attempt %d), got: %v", i+1, err)
+		}
+		s.Close()
+	}
+}
+
+func TestMigrationHashesRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "chirpy.db")
+
+	// Build the schema as it was before refresh tokens were hashed.
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatalf("Expected no error opening database, got: %v", err)
+	}
+	for i, file := range []string{"001_init.sql", "002_login_lockout.sql", "003_access_token_revocation.sql", "004_personal_access_tokens.sql"} {
+		stmts, _ := migrations.ReadFile("migrations/" + file)
+		if _, err := db.ExecContext(ctx, string(stmts)); err != nil {
+			t.Fatalf("%s: expected no error, got: %v", file, err)
+		}
+		db.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", i+1))
+	}
+	userID := uuid.New()
+	db.ExecContext(ctx, "INSERT INTO users (id, created_at, updated_at, email, hashed_password) VALUES (?, 0, 0, 'a@example.com', 'hash')", userID)
+	if _, err := db.ExecContext(ctx, "INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at) VALUES ('plain', 0, 0, ?, 0)", userID); err != nil {
+		t.Fatalf("Expected no error inserting refresh token, got: %v", err)
+	}
+	db.Close()
+
+	s, err := Open(ctx, path)
+	if err != nil {
+		t.Fatalf("Expected no error migrating, got: %v", err)
+	}
+	defer s.Close()
+	sum := sha256.Sum256([]byte("plain"))
+	if got, err := s.GetRefreshToken(ctx, hex.EncodeToString(sum[:])); err != nil || got.UserID != userID {
+		t.Errorf("Expected the refresh token to be found by its hash, got: %+v, %v", got, err)
+	}
+	if _, err := s.GetRefreshToken(ctx, "plain"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected the plaintext token to be gone, got: %v", err)
+	}
+}
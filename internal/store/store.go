@@ -0,0 +1,29 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/jdwalkerzhere/httpServer/internal/database"
+	"github.com/lib/pq"
+)
+
+// Store is every query the API runs against persistent state. The
+// sqlc-generated *database.Queries implements it on Postgres; the memory and
+// sqlite subpackages implement it without a database server.
+type Store interface {
+	database.Querier
+}
+
+// ErrUniqueViolation is returned by the non-Postgres backends when a write
+// would break a uniqueness constraint, such as two users sharing an email.
+var ErrUniqueViolation = errors.New("unique constraint violation")
+
+// IsUniqueViolation reports whether err means a write was rejected by a
+// uniqueness constraint, whichever backend produced it.
+func IsUniqueViolation(err error) bool {
+	if errors.Is(err, ErrUniqueViolation) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,436 @@
+// Package storetest is a conformance suite that every store.Store
+// implementation runs from its own tests, so the backends cannot drift
+// apart from each other or from the Postgres queries they stand in for.
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jdwalkerzhere/httpServer/internal/database"
+	"github.com/jdwalkerzhere/httpServer/internal/store"
+)
+
+// Run exercises newStore's result against the behaviour the handlers rely
+// on. newStore must return an empty store each time it is called.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"Users", testUsers},
+		{"LoginFailures", testLoginFailures},
+		{"Chirps", testChirps},
+		{"ListChirps", testListChirps},
+		{"RefreshTokens", testRefreshTokens},
+		{"AccessTokenRevocation", testAccessTokenRevocation},
+		{"PersonalAccessTokens", testPersonalAccessTokens},
+		{"Reset", testReset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+var base = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func createUser(t *testing.T, s store.Store, email string) database.User {
+	t.Helper()
+	u, err := s.CreateUser(context.Background(), database.CreateUserParams{
+		ID:             uuid.New(),
+		CreatedAt:      base,
+		UpdatedAt:      base,
+		Email:          email,
+		HashedPassword: "hash",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error creating %s, got: %v", email, err)
+	}
+	return u
+}
+
+func createChirp(t *testing.T, s store.Store, userID uuid.UUID, createdAt time.Time) database.Chirp {
+	t.Helper()
+	c, err := s.CreateChirp(context.Background(), database.CreateChirpParams{
+		ID:        uuid.New(),
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Body:      "hello",
+		UserID:    userID,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error creating chirp, got: %v", err)
+	}
+	return c
+}
+
+func testUsers(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "a@example.com")
+	if !u.CreatedAt.Equal(base) || u.IsChirpyRed || u.IsAdmin {
+		t.Errorf("Unexpected new user: %+v", u)
+	}
+
+	_, err := s.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), Email: "a@example.com"})
+	if !store.IsUniqueViolation(err) {
+		t.Errorf("Expected unique violation for duplicate email, got: %v", err)
+	}
+
+	got, err := s.GetUserByEmail(ctx, "a@example.com")
+	if err != nil || got.ID != u.ID {
+		t.Errorf("Expected to find user by email, got: %+v, %v", got, err)
+	}
+	if _, err := s.GetUser(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for unknown user, got: %v", err)
+	}
+
+	later := base.Add(time.Minute)
+	updated, err := s.UpdateUser(ctx, database.UpdateUserParams{
+		ID: u.ID, Email: "b@example.com", HashedPassword: "hash2", UpdatedAt: later,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error updating user, got: %v", err)
+	}
+	if updated.Email != "b@example.com" || updated.HashedPassword != "hash2" || !updated.UpdatedAt.Equal(later) {
+		t.Errorf("Unexpected updated user: %+v", updated)
+	}
+
+	if err := s.UpdatePasswordHash(ctx, database.UpdatePasswordHashParams{ID: u.ID, HashedPassword: "hash3"}); err != nil {
+		t.Fatalf("Expected no error updating password hash, got: %v", err)
+	}
+	got, _ = s.GetUser(ctx, u.ID)
+	if got.HashedPassword != "hash3" || !got.UpdatedAt.Equal(later) {
+		t.Errorf("Expected only the password hash to change, got: %+v", got)
+	}
+
+	other := createUser(t, s, "c@example.com")
+	_, err = s.UpdateUser(ctx, database.UpdateUserParams{ID: other.ID, Email: "b@example.com", HashedPassword: "x", UpdatedAt: later})
+	if !store.IsUniqueViolation(err) {
+		t.Errorf("Expected unique violation when taking another user's email, got: %v", err)
+	}
+
+	red, err := s.UpgradeUserToChirpyRed(ctx, database.UpgradeUserToChirpyRedParams{ID: u.ID, UpdatedAt: later})
+	if err != nil || !red.IsChirpyRed {
+		t.Errorf("Expected user to be upgraded, got: %+v, %v", red, err)
+	}
+	if _, err := s.UpgradeUserToChirpyRed(ctx, database.UpgradeUserToChirpyRedParams{ID: uuid.New(), UpdatedAt: later}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows upgrading unknown user, got: %v", err)
+	}
+}
+
+func testLoginFailures(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "a@example.com")
+
+	for want := int32(1); want <= 2; want++ {
+		got, err := s.RecordFailedLogin(ctx, u.ID)
+		if err != nil || got != want {
+			t.Fatalf("Expected %d failed attempts, got: %d, %v", want, got, err)
+		}
+	}
+	lockedUntil := sql.NullTime{Time: base.Add(time.Hour), Valid: true}
+	if err := s.LockUser(ctx, database.LockUserParams{ID: u.ID, LockedUntil: lockedUntil}); err != nil {
+		t.Fatalf("Expected no error locking user, got: %v", err)
+	}
+	got, _ := s.GetUser(ctx, u.ID)
+	if got.FailedLoginAttempts != 2 || !got.LockedUntil.Time.Equal(lockedUntil.Time) {
+		t.Errorf("Expected lockout to be recorded, got: %+v", got)
+	}
+
+	got, err := s.ResetLoginFailures(ctx, u.ID)
+	if err != nil || got.FailedLoginAttempts != 0 || got.LockedUntil.Valid {
+		t.Errorf("Expected lockout to be cleared, got: %+v, %v", got, err)
+	}
+	if _, err := s.ResetLoginFailures(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for unknown user, got: %v", err)
+	}
+}
+
+func testAccessTokenRevocation(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "a@example.com")
+
+	check := func(jti string) database.GetAccessTokenRevocationRow {
+		t.Helper()
+		row, err := s.GetAccessTokenRevocation(ctx, database.GetAccessTokenRevocationParams{ID: u.ID, Jti: jti})
+		if err != nil {
+			t.Fatalf("Expected no error checking revocation, got: %v", err)
+		}
+		return row
+	}
+	if row := check("jti-1"); row.Revoked || row.TokenVersion != 0 {
+		t.Errorf("Expected nothing revoked yet, got: %+v", row)
+	}
+
+	for _, jti := range []string{"jti-1", "jti-1", "jti-2"} {
+		if err := s.RevokeAccessToken(ctx, database.RevokeAccessTokenParams{Jti: jti, ExpiresAt: base.Add(time.Hour)}); err != nil {
+			t.Fatalf("Expected no error revoking %s twice, got: %v", jti, err)
+		}
+	}
+	s.RevokeAccessToken(ctx, database.RevokeAccessTokenParams{Jti: "jti-3", ExpiresAt: base.Add(3 * time.Hour)})
+	if !check("jti-1").Revoked || check("jti-4").Revoked {
+		t.Error("Expected only revoked jtis to be reported")
+	}
+
+	pruned, err := s.PruneRevokedAccessTokens(ctx, base.Add(2*time.Hour))
+	if err != nil || pruned != 2 {
+		t.Errorf("Expected the two expired entries pruned, got: %d, %v", pruned, err)
+	}
+	if check("jti-1").Revoked || !check("jti-3").Revoked {
+		t.Error("Expected only expired entries to be pruned")
+	}
+
+	for want := int32(1); want <= 2; want++ {
+		if got, err := s.BumpTokenVersion(ctx, u.ID); err != nil || got != want {
+			t.Fatalf("Expected token version %d, got: %d, %v", want, got, err)
+		}
+	}
+	if row := check("jti-5"); row.TokenVersion != 2 {
+		t.Errorf("Expected token version 2, got: %+v", row)
+	}
+	if got, _ := s.GetUser(ctx, u.ID); got.TokenVersion != 2 {
+		t.Errorf("Expected the user to carry token version 2, got: %+v", got)
+	}
+	if _, err := s.BumpTokenVersion(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows bumping an unknown user, got: %v", err)
+	}
+	if _, err := s.GetAccessTokenRevocation(ctx, database.GetAccessTokenRevocationParams{ID: uuid.New(), Jti: "jti-1"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for unknown user, got: %v", err)
+	}
+}
+
+func testChirps(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "a@example.com")
+	c := createChirp(t, s, u.ID, base)
+
+	got, err := s.GetChirp(ctx, c.ID)
+	if err != nil || got.Body != "hello" || got.UserID != u.ID || got.DeletedAt.Valid {
+		t.Errorf("Unexpected chirp: %+v, %v", got, err)
+	}
+
+	_, err = s.CreateChirp(ctx, database.CreateChirpParams{ID: uuid.New(), Body: "orphan", UserID: uuid.New()})
+	if err == nil {
+		t.Error("Expected an error creating a chirp for an unknown user")
+	}
+
+	deletedAt := sql.NullTime{Time: base.Add(time.Hour), Valid: true}
+	if err := s.DeleteChirp(ctx, database.DeleteChirpParams{ID: c.ID, DeletedAt: deletedAt}); err != nil {
+		t.Fatalf("Expected no error deleting chirp, got: %v", err)
+	}
+	if _, err := s.GetChirp(ctx, c.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected deleted chirp to be hidden, got: %v", err)
+	}
+}
+
+func testListChirps(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	alice := createUser(t, s, "alice@example.com")
+	bob := createUser(t, s, "bob@example.com")
+
+	var chirps []database.Chirp
+	for i := 0; i < 4; i++ {
+		author := alice
+		if i%2 == 1 {
+			author = bob
+		}
+		chirps = append(chirps, createChirp(t, s, author.ID, base.Add(time.Duration(i)*time.Minute)))
+	}
+	deleted := createChirp(t, s, alice.ID, base.Add(10*time.Minute))
+	s.DeleteChirp(ctx, database.DeleteChirpParams{ID: deleted.ID, DeletedAt: sql.NullTime{Time: base, Valid: true}})
+
+	ids := func(cs []database.Chirp) []uuid.UUID {
+		out := []uuid.UUID{}
+		for _, c := range cs {
+			out = append(out, c.ID)
+		}
+		return out
+	}
+	check := func(name string, got []database.Chirp, err error, want ...database.Chirp) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", name, err)
+		}
+		g, w := ids(got), ids(want)
+		if len(g) != len(w) {
+			t.Fatalf("%s: expected %v, got: %v", name, w, g)
+		}
+		for i := range g {
+			if g[i] != w[i] {
+				t.Fatalf("%s: expected %v, got: %v", name, w, g)
+			}
+		}
+	}
+
+	got, err := s.ListChirpsAsc(ctx, database.ListChirpsAscParams{RowLimit: 10})
+	check("asc", got, err, chirps...)
+
+	got, err = s.ListChirpsDesc(ctx, database.ListChirpsDescParams{RowLimit: 2})
+	check("desc limit", got, err, chirps[3], chirps[2])
+
+	got, err = s.ListChirpsAsc(ctx, database.ListChirpsAscParams{
+		AuthorID: uuid.NullUUID{UUID: bob.ID, Valid: true},
+		RowLimit: 10,
+	})
+	check("author", got, err, chirps[1], chirps[3])
+
+	got, err = s.ListChirpsAsc(ctx, database.ListChirpsAscParams{
+		Since:    sql.NullTime{Time: chirps[1].CreatedAt, Valid: true},
+		Until:    sql.NullTime{Time: chirps[2].CreatedAt, Valid: true},
+		RowLimit: 10,
+	})
+	check("since until", got, err, chirps[1], chirps[2])
+
+	got, err = s.ListChirpsAsc(ctx, database.ListChirpsAscParams{
+		CursorCreatedAt: sql.NullTime{Time: chirps[1].CreatedAt, Valid: true},
+		CursorID:        uuid.NullUUID{UUID: chirps[1].ID, Valid: true},
+		RowLimit:        10,
+	})
+	check("asc cursor", got, err, chirps[2], chirps[3])
+
+	got, err = s.ListChirpsDesc(ctx, database.ListChirpsDescParams{
+		CursorCreatedAt: sql.NullTime{Time: chirps[2].CreatedAt, Valid: true},
+		CursorID:        uuid.NullUUID{UUID: chirps[2].ID, Valid: true},
+		RowLimit:        10,
+	})
+	check("desc cursor", got, err, chirps[1], chirps[0])
+}
+
+func testRefreshTokens(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "a@example.com")
+	for _, token := range []string{"one", "two"} {
+		_, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			TokenHash: token, CreatedAt: base, UpdatedAt: base, UserID: u.ID, ExpiresAt: base.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("Expected no error creating refresh token, got: %v", err)
+		}
+	}
+
+	got, err := s.GetRefreshToken(ctx, "one")
+	if err != nil || got.UserID != u.ID || !got.ExpiresAt.Equal(base.Add(time.Hour)) || got.RevokedAt.Valid {
+		t.Errorf("Unexpected refresh token: %+v, %v", got, err)
+	}
+
+	revokedAt := sql.NullTime{Time: base.Add(time.Minute), Valid: true}
+	revoked, err := s.RevokeRefreshToken(ctx, database.RevokeRefreshTokenParams{TokenHash: "one", RevokedAt: revokedAt})
+	if err != nil || !revoked.RevokedAt.Time.Equal(revokedAt.Time) {
+		t.Errorf("Expected token to be revoked, got: %+v, %v", revoked, err)
+	}
+	if _, err := s.RevokeRefreshToken(ctx, database.RevokeRefreshTokenParams{TokenHash: "one", RevokedAt: revokedAt}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows revoking twice, got: %v", err)
+	}
+
+	if err := s.RevokeAllRefreshTokensForUser(ctx, database.RevokeAllRefreshTokensForUserParams{UserID: u.ID, RevokedAt: revokedAt}); err != nil {
+		t.Fatalf("Expected no error revoking all tokens, got: %v", err)
+	}
+	if got, _ := s.GetRefreshToken(ctx, "two"); !got.RevokedAt.Valid {
+		t.Error("Expected every token of the user to be revoked")
+	}
+}
+
+func testPersonalAccessTokens(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "a@example.com")
+	other := createUser(t, s, "b@example.com")
+	create := func(userID uuid.UUID, hash string, createdAt time.Time) database.PersonalAccessToken {
+		t.Helper()
+		pat, err := s.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+			ID: uuid.New(), CreatedAt: createdAt, UserID: userID, Name: "bot", TokenHash: hash, Scopes: "chirps:write",
+		})
+		if err != nil {
+			t.Fatalf("Expected no error creating personal access token, got: %v", err)
+		}
+		return pat
+	}
+	second := create(u.ID, "hash-2", base.Add(time.Minute))
+	first := create(u.ID, "hash-1", base)
+	create(other.ID, "hash-3", base)
+
+	_, err := s.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{ID: uuid.New(), UserID: u.ID, TokenHash: "hash-1"})
+	if !store.IsUniqueViolation(err) {
+		t.Errorf("Expected a unique violation for a duplicate hash, got: %v", err)
+	}
+
+	got, err := s.GetPersonalAccessTokenByHash(ctx, "hash-1")
+	if err != nil || got.ID != first.ID || got.UserID != u.ID || got.Scopes != "chirps:write" || got.ExpiresAt.Valid || got.LastUsedAt.Valid {
+		t.Errorf("Unexpected personal access token: %+v, %v", got, err)
+	}
+	if _, err := s.GetPersonalAccessTokenByHash(ctx, "nope"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for an unknown hash, got: %v", err)
+	}
+
+	usedAt := sql.NullTime{Time: base.Add(time.Hour), Valid: true}
+	if err := s.TouchPersonalAccessToken(ctx, database.TouchPersonalAccessTokenParams{ID: first.ID, LastUsedAt: usedAt}); err != nil {
+		t.Fatalf("Expected no error touching token, got: %v", err)
+	}
+	list, err := s.ListPersonalAccessTokens(ctx, u.ID)
+	if err != nil || len(list) != 2 || list[0].ID != first.ID || list[1].ID != second.ID {
+		t.Fatalf("Expected the user's two tokens, oldest first, got: %+v, %v", list, err)
+	}
+	if !list[0].LastUsedAt.Time.Equal(usedAt.Time) {
+		t.Errorf("Expected last_used_at to be recorded, got: %+v", list[0].LastUsedAt)
+	}
+
+	revokedAt := sql.NullTime{Time: base.Add(2 * time.Hour), Valid: true}
+	revoke := func(id, userID uuid.UUID) int64 {
+		n, err := s.RevokePersonalAccessToken(ctx, database.RevokePersonalAccessTokenParams{ID: id, UserID: userID, RevokedAt: revokedAt})
+		if err != nil {
+			t.Fatalf("Expected no error revoking token, got: %v", err)
+		}
+		return n
+	}
+	if n := revoke(first.ID, other.ID); n != 0 {
+		t.Errorf("Expected another user's token to be left alone, revoked %d", n)
+	}
+	if n := revoke(first.ID, u.ID); n != 1 {
+		t.Errorf("Expected one token revoked, got: %d", n)
+	}
+	if n := revoke(first.ID, u.ID); n != 0 {
+		t.Errorf("Expected revoking twice to do nothing, revoked %d", n)
+	}
+	if got, _ := s.GetPersonalAccessTokenByHash(ctx, "hash-1"); !got.RevokedAt.Time.Equal(revokedAt.Time) {
+		t.Errorf("Expected revoked_at to be set, got: %+v", got.RevokedAt)
+	}
+	if list, _ := s.ListPersonalAccessTokens(ctx, u.ID); len(list) != 1 || list[0].ID != second.ID {
+		t.Errorf("Expected revoked tokens to be left out of the list, got: %+v", list)
+	}
+
+	allAt := sql.NullTime{Time: base.Add(3 * time.Hour), Valid: true}
+	if err := s.RevokeAllPersonalAccessTokensForUser(ctx, database.RevokeAllPersonalAccessTokensForUserParams{UserID: u.ID, RevokedAt: allAt}); err != nil {
+		t.Fatalf("Expected no error revoking all tokens, got: %v", err)
+	}
+	if list, _ := s.ListPersonalAccessTokens(ctx, u.ID); len(list) != 0 {
+		t.Errorf("Expected every token to be revoked, got: %+v", list)
+	}
+	if got, _ := s.GetPersonalAccessTokenByHash(ctx, "hash-1"); !got.RevokedAt.Time.Equal(revokedAt.Time) {
+		t.Errorf("Expected an already revoked token to keep its revoked_at, got: %+v", got.RevokedAt)
+	}
+	if list, _ := s.ListPersonalAccessTokens(ctx, other.ID); len(list) != 1 {
+		t.Errorf("Expected another user's tokens to be left alone, got: %+v", list)
+	}
+}
+
+func testReset(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	u := createUser(t, s, "a@example.com")
+	createChirp(t, s, u.ID, base)
+
+	if err := s.Reset(ctx); err != nil {
+		t.Fatalf("Expected no error resetting, got: %v", err)
+	}
+	if _, err := s.GetUser(ctx, u.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected users to be gone, got: %v", err)
+	}
+	got, err := s.ListChirpsAsc(ctx, database.ListChirpsAscParams{RowLimit: 10})
+	if err != nil || len(got) != 0 {
+		t.Errorf("Expected chirps to be gone, got: %v, %v", got, err)
+	}
+}
@@ -0,0 +1,36 @@
+package validate
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+// maxEmailLength is the longest address SMTP can carry (RFC 5321).
+const maxEmailLength = 254
+
+// Email checks that s is a single bare RFC 5322 address and returns it
+// trimmed and lowercased, the form it is stored and looked up in.
+func Email(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", errors.New("must not be empty")
+	}
+	if len(s) > maxEmailLength {
+		return "", errors.New("is too long")
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" || addr.Address != s {
+		return "", errors.New("must be an email address like name@example.com")
+	}
+	if _, domain, _ := strings.Cut(addr.Address, "@"); !strings.Contains(domain, ".") || strings.HasPrefix(domain, "[") {
+		return "", errors.New("must be an email address like name@example.com")
+	}
+	return NormalizeEmail(addr.Address), nil
+}
+
+// NormalizeEmail trims and lowercases s without checking it, for looking up
+// addresses that were validated when they were stored.
+func NormalizeEmail(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
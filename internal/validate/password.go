@@ -0,0 +1,110 @@
+package validate
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPasswordBytes is the most bcrypt will hash; longer passwords are
+// rejected rather than silently truncated.
+const maxPasswordBytes = 72
+
+//go:embed common-passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]bool {
+	set := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(commonPasswordList))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			set[strings.ToLower(line)] = true
+		}
+	}
+	return set
+}()
+
+// PasswordPolicy is what a new password must satisfy.
+type PasswordPolicy struct {
+	MinLength int
+	// MinEntropy is the minimum estimated strength in bits, see Entropy.
+	MinEntropy int
+}
+
+// Check returns why password is unacceptable, or nil. email is the account's
+// address, which the password may not repeat.
+func (p PasswordPolicy) Check(password, email string) error {
+	length := utf8.RuneCountInString(password)
+	switch {
+	case length < p.MinLength:
+		return fmt.Errorf("must be at least %d characters", p.MinLength)
+	case len(password) > maxPasswordBytes:
+		return fmt.Errorf("must be at most %d bytes", maxPasswordBytes)
+	case commonPasswords[strings.ToLower(password)]:
+		return errors.New("is too common")
+	}
+	lower := strings.ToLower(password)
+	if local, _, _ := strings.Cut(strings.ToLower(email), "@"); local != "" && strings.Contains(lower, local) {
+		return errors.New("must not contain your email address")
+	}
+	if Entropy(password) < float64(p.MinEntropy) {
+		return errors.New("is too easy to guess; use a longer password or more kinds of characters")
+	}
+	return nil
+}
+
+// Entropy estimates a password's strength in bits as if it were drawn at
+// random from the character classes it uses. A character that repeats the
+// previous one or is next to it in sequence ("aaaa", "1234", "dcba") adds
+// nothing.
+func Entropy(password string) float64 {
+	var (
+		lower, upper, digit, symbol, other bool
+		effective                          int
+		prev                               rune
+	)
+	for i, r := range []rune(password) {
+		switch {
+		case r >= utf8.RuneSelf:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+		if d := r - prev; i == 0 || d < -1 || d > 1 {
+			effective++
+		}
+		prev = r
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{
+		{lower, 26},
+		{upper, 26},
+		{digit, 10},
+		{symbol, 33},
+		{other, 100},
+	} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(effective) * math.Log2(float64(pool))
+}
@@ -0,0 +1,83 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MinEntropy: 35}
+	tests := []struct {
+		password string
+		wantErr  string
+	}{
+		{"", "must be at least 8 characters"},
+		{"Ab1!", "must be at least 8 characters"},
+		{strings.Repeat("x9!Q", 19), "must be at most 72 bytes"},
+		{"password123", "is too common"},
+		{"QWERTY123", "is too common"},
+		{"saul.goodman!77", "must not contain your email address"},
+		{"aaaaaaaaaaaa", "is too easy to guess"},
+		{"abcdefghijklmnop", "is too easy to guess"},
+		{"12345678987654321", "is too easy to guess"},
+		{"correct horse battery staple", ""},
+		{"Tr0ub4dor&3", ""},
+		{"żółć gęślą jaźń", ""},
+	}
+	for _, tt := range tests {
+		err := policy.Check(tt.password, "Saul.Goodman@example.com")
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%q: expected no error, got: %v", tt.password, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%q: expected error containing %q, got: %v", tt.password, tt.wantErr, err)
+		}
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		want     float64
+	}{
+		{"", 0},
+		{"aaaa", 4.70},
+		{"abcd", 4.70},
+		{"azaz", 18.80},
+		{"aZ9!", 26.28},
+	}
+	for _, tt := range tests {
+		if got := Entropy(tt.password); got < tt.want-0.01 || got > tt.want+0.01 {
+			t.Errorf("%q: expected %.2f bits, got: %.2f", tt.password, tt.want, got)
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		input, want, wantErr string
+	}{
+		{"  Saul@BetterCall.com ", "saul@bettercall.com", ""},
+		{"first.last+tag@sub.example.org", "first.last+tag@sub.example.org", ""},
+		{"", "", "must not be empty"},
+		{"   ", "", "must not be empty"},
+		{"not-an-email", "", "must be an email address"},
+		{"Saul <saul@bettercall.com>", "", "must be an email address"},
+		{"saul@localhost", "", "must be an email address"},
+		{"a@b.c, d@e.f", "", "must be an email address"},
+		{"saul@@bettercall.com", "", "must be an email address"},
+		{strings.Repeat("a", 250) + "@b.co", "", "is too long"},
+	}
+	for _, tt := range tests {
+		got, err := Email(tt.input)
+		if tt.wantErr == "" {
+			if err != nil || got != tt.want {
+				t.Errorf("%q: expected %q, got: %q, %v", tt.input, tt.want, got, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: expected error containing %q, got: %q, %v", tt.input, tt.wantErr, got, err)
+		}
+	}
+}
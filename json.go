@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/jdwalkerzhere/httpServer/internal/logging"
+	"github.com/jdwalkerzhere/httpServer/internal/response"
+)
+
+func respondJSON(w http.ResponseWriter, status int, payload any) {
+	response.JSON(w, status, payload)
+}
+
+// respondError writes an error response. err is the underlying cause, if
+// any; it goes to the request log and is never shown to the client.
+func respondError(w http.ResponseWriter, r *http.Request, status int, code, msg string, err error) {
+	if err != nil {
+		logging.SetError(r.Context(), err)
+	}
+	response.WriteError(w, r, response.Error{Status: status, Code: code, Message: msg})
+}
+
+// respondValidationError rejects a request whose fields failed validation.
+func respondValidationError(w http.ResponseWriter, r *http.Request, msg string, fields ...response.FieldError) {
+	response.WriteError(w, r, response.Error{
+		Status:  http.StatusBadRequest,
+		Code:    response.CodeValidationFailed,
+		Message: msg,
+		Fields:  fields,
+	})
+}
@@ -1,52 +1,156 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
-	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/jdwalkerzhere/httpServer/internal/auth"
+	"github.com/jdwalkerzhere/httpServer/internal/config"
 	"github.com/jdwalkerzhere/httpServer/internal/database"
-	"github.com/joho/godotenv"
+	"github.com/jdwalkerzhere/httpServer/internal/logging"
+	"github.com/jdwalkerzhere/httpServer/internal/metrics"
+	"github.com/jdwalkerzhere/httpServer/internal/migrate"
+	"github.com/jdwalkerzhere/httpServer/internal/pagination"
+	"github.com/jdwalkerzhere/httpServer/internal/response"
+	"github.com/jdwalkerzhere/httpServer/internal/store"
+	"github.com/jdwalkerzhere/httpServer/internal/store/memory"
+	"github.com/jdwalkerzhere/httpServer/internal/store/sqlite"
+	"github.com/jdwalkerzhere/httpServer/internal/validate"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	fileServerHits atomic.Int32
-	db             *database.Queries
-	authSecret     string
+	fileServerHits *metrics.Counter
+	chirpsCreated  *metrics.Counter
+	usersCreated   *metrics.Counter
+	httpMetrics    *metrics.HTTPMetrics
+	db             store.Store
+	cursorKey      []byte
+	jwtKeys        *auth.Keyring
+	authn          *auth.Authenticator
+	polkaKey       string
+	metricsToken   string
+	platform       string
+
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+
+	passwordPolicy   validate.PasswordPolicy
+	passwords        *auth.PasswordHasher
+	lockoutThreshold int
+	lockoutBase      time.Duration
+	lockoutMax       time.Duration
 }
 
 func (c *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		c.fileServerHits.Add(1)
+		c.fileServerHits.Inc()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// middlewareAdminOnly rejects requests that do not carry a valid access token
+// belonging to a user with the admin role.
+func (c *apiConfig) middlewareAdminOnly(next http.Handler) http.Handler {
+	return c.authn.Required(c.authn.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.MustPrincipal(r.Context()).User.IsAdmin {
+			respondError(w, r, http.StatusForbidden, response.CodeForbidden, "Admin access required", nil)
+			return
+		}
 		next.ServeHTTP(w, r)
+	})))
+}
+
+// middlewareMetricsScraper lets requests carrying the metrics token through,
+// so scrapers need no login, and leaves the rest to middlewareAdminOnly.
+func (c *apiConfig) middlewareMetricsScraper(next http.Handler) http.Handler {
+	adminOnly := c.middlewareAdminOnly(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err == nil && c.metricsToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.metricsToken)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		adminOnly.ServeHTTP(w, r)
 	})
 }
 
+// jwks publishes the public keys that verify access tokens, so other
+// services can check them without being able to issue them.
+func (cfg *apiConfig) jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondJSON(w, http.StatusOK, cfg.jwtKeys.JWKS())
+}
+
 func healthz(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
+func newAPIConfig(registry *metrics.Registry) *apiConfig {
+	return &apiConfig{
+		fileServerHits: registry.NewCounter("chirpy_fileserver_hits_total", "Requests served from /app/."),
+		chirpsCreated:  registry.NewCounter("chirpy_chirps_created_total", "Chirps created."),
+		usersCreated:   registry.NewCounter("chirpy_users_created_total", "Users created."),
+		httpMetrics:    metrics.NewHTTPMetrics(registry),
+	}
+}
+
+var metricsPage = template.Must(template.New("metrics").Parse(`<html><body><h1>Welcome, Chirpy Admin</h1>` +
+	`<p>Chirpy has been visited {{.Hits}} times!</p>` +
+	`<p>{{.Users}} users and {{.Chirps}} chirps created.</p>` +
+	`<table><tr><th>Route</th><th>Status</th><th>Requests</th></tr>` +
+	`{{range .Requests}}<tr><td>{{index .Labels "route"}}</td><td>{{index .Labels "code"}}</td><td>{{.Value}}</td></tr>{{end}}` +
+	`</table></body></html>`))
+
+// metrics renders the same counters exposed on /metrics as an HTML page.
 func (c *apiConfig) metrics(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
-	out := fmt.Sprintf("<html><body><h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited %d times!</p></body></html>", c.fileServerHits.Load())
-	w.Write([]byte(out))
+	metricsPage.Execute(w, struct {
+		Hits, Users, Chirps uint64
+		Requests            []metrics.Sample
+	}{
+		Hits:     c.fileServerHits.Value(),
+		Users:    c.usersCreated.Value(),
+		Chirps:   c.chirpsCreated.Value(),
+		Requests: c.httpMetrics.Requests.Snapshot(),
+	})
 }
 
+// reset wipes every user (and, by cascade, their chirps and tokens). It is
+// only available when PLATFORM is "dev".
 func (c *apiConfig) reset(w http.ResponseWriter, r *http.Request) {
+	if c.platform != "dev" {
+		respondError(w, r, http.StatusForbidden, response.CodeForbidden, "Reset is only allowed in dev", nil)
+		return
+	}
+	c.fileServerHits.Reset()
+	if err := c.db.Reset(r.Context()); err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
-	c.fileServerHits.Swap(0)
-	c.db.Reset(r.Context())
 }
 
 type Chirp struct {
@@ -61,12 +165,11 @@ type ChirpRequest struct {
 	Body string `json:"body"`
 }
 
-type httpError struct {
-	Message string `json:"error"`
-}
-
 func (cfg *apiConfig) handlerChirp(w http.ResponseWriter, r *http.Request) {
-	const maxChirpLength = 140
+	const (
+		maxChirpLength          = 140
+		maxChirpyRedChirpLength = 280
+	)
 	profane := map[string]bool{
 		"kerfuffle": true,
 		"sharbert":  true,
@@ -75,32 +178,23 @@ func (cfg *apiConfig) handlerChirp(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
-	bearerToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(httpError{"User Not Logged In"})
-		return
-	}
-
-	id, err := auth.ValidateJWT(bearerToken, cfg.authSecret)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(httpError{"Invalid JWT Token"})
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
+	author := auth.MustPrincipal(r.Context()).User
 
 	chirpRequest := ChirpRequest{}
-	err = json.NewDecoder(r.Body).Decode(&chirpRequest)
+	err := json.NewDecoder(r.Body).Decode(&chirpRequest)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(httpError{"Something went wrong"})
+		respondError(w, r, http.StatusBadRequest, response.CodeMalformedRequest, "Malformed Request", err)
 		return
 	}
-	if len(chirpRequest.Body) > maxChirpLength {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(httpError{"Chirp is too long"})
+	chirpLimit := maxChirpLength
+	if author.IsChirpyRed {
+		chirpLimit = maxChirpyRedChirpLength
+	}
+	if utf8.RuneCountInString(chirpRequest.Body) > chirpLimit {
+		respondValidationError(w, r, "Chirp is too long", response.FieldError{
+			Field:   "body",
+			Message: fmt.Sprintf("must be at most %d characters", chirpLimit),
+		})
 		return
 	}
 
@@ -110,15 +204,14 @@ func (cfg *apiConfig) handlerChirp(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: timeNow,
 		UpdatedAt: timeNow,
 		Body:      cleanChirp(Chirp{Body: chirpRequest.Body}, profane),
-		UserID:    id,
+		UserID:    author.ID,
 	}
 	chirp, err := cfg.db.CreateChirp(r.Context(), chirpParams)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(httpError{"Error Saving Chirp"})
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Error Saving Chirp", err)
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	cfg.chirpsCreated.Inc()
 	chirpResponse := Chirp{
 		ID:        chirp.ID,
 		CreatedAt: chirp.CreatedAt,
@@ -126,8 +219,7 @@ func (cfg *apiConfig) handlerChirp(w http.ResponseWriter, r *http.Request) {
 		Body:      chirp.Body,
 		UserID:    chirp.UserID,
 	}
-	json.NewEncoder(w).Encode(chirpResponse)
-
+	respondJSON(w, http.StatusCreated, chirpResponse)
 }
 
 func cleanChirp(c Chirp, p map[string]bool) string {
@@ -144,12 +236,14 @@ func cleanChirp(c Chirp, p map[string]bool) string {
 }
 
 type User struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Email     string    `json:"email"`
-	Token     string    `json:"token"`
-	Password  string    `json:"-"`
+	ID           uuid.UUID `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Email        string    `json:"email"`
+	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	Password     string    `json:"-"`
 }
 
 func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
@@ -162,52 +256,157 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 	fields := userFields{}
 	err := json.NewDecoder(r.Body).Decode(&fields)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("Request [%s] Malformed", r.Body)))
+		respondError(w, r, http.StatusBadRequest, response.CodeMalformedRequest, "Malformed Request", err)
+		return
+	}
+	var fieldErrs []response.FieldError
+	email, err := validate.Email(fields.Email)
+	if err != nil {
+		fieldErrs = append(fieldErrs, response.FieldError{Field: "email", Message: err.Error()})
+	}
+	if err := cfg.passwordPolicy.Check(fields.Password, fields.Email); err != nil {
+		fieldErrs = append(fieldErrs, response.FieldError{Field: "password", Message: err.Error()})
+	}
+	if len(fieldErrs) > 0 {
+		respondValidationError(w, r, "Invalid email or password", fieldErrs...)
 		return
 	}
 	timeNow := time.Now()
-	hashedPassword, err := auth.HashPassword(fields.Password)
+	hashedPassword, err := cfg.passwords.Hash(fields.Password)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(httpError{"Error Hashing Password"})
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Error Hashing Password", err)
 		return
 	}
 	userParams := database.CreateUserParams{
 		ID:             uuid.New(),
 		CreatedAt:      timeNow,
 		UpdatedAt:      timeNow,
-		Email:          fields.Email,
+		Email:          email,
 		HashedPassword: hashedPassword,
 	}
 	dbUser, err := cfg.db.CreateUser(r.Context(), userParams)
+	if store.IsUniqueViolation(err) {
+		respondError(w, r, http.StatusConflict, response.CodeConflict, "Email already in use", nil)
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Could not create user"))
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Could not create user", err)
 		return
 	}
+	cfg.usersCreated.Inc()
 	user := User{
-		ID:        dbUser.ID,
-		CreatedAt: dbUser.CreatedAt,
-		UpdatedAt: dbUser.UpdatedAt,
-		Email:     dbUser.Email,
+		ID:          dbUser.ID,
+		CreatedAt:   dbUser.CreatedAt,
+		UpdatedAt:   dbUser.UpdatedAt,
+		Email:       dbUser.Email,
+		IsChirpyRed: dbUser.IsChirpyRed,
 	}
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
+	respondJSON(w, http.StatusCreated, user)
+}
+
+func (cfg *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
+	type userFields struct {
+		Password *string `json:"password"`
+		Email    *string `json:"email"`
+	}
+	defer r.Body.Close()
+
+	id := auth.MustPrincipal(r.Context()).User.ID
+
+	fields := userFields{}
+	err := json.NewDecoder(r.Body).Decode(&fields)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, response.CodeMalformedRequest, "Malformed Request", err)
+		return
+	}
+	if fields.Email == nil && fields.Password == nil {
+		respondValidationError(w, r, "Nothing to update",
+			response.FieldError{Field: "email", Message: "email or password is required"},
+			response.FieldError{Field: "password", Message: "email or password is required"},
+		)
+		return
+	}
+
+	dbUser, err := cfg.db.GetUser(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusNotFound, response.CodeNotFound, "User not found", nil)
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	userParams := database.UpdateUserParams{
+		ID:             dbUser.ID,
+		Email:          dbUser.Email,
+		HashedPassword: dbUser.HashedPassword,
+		UpdatedAt:      time.Now(),
+	}
+
+	var fieldErrs []response.FieldError
+	if fields.Email != nil {
+		userParams.Email, err = validate.Email(*fields.Email)
+		if err != nil {
+			fieldErrs = append(fieldErrs, response.FieldError{Field: "email", Message: err.Error()})
+		}
+	}
+	if fields.Password != nil {
+		if err := cfg.passwordPolicy.Check(*fields.Password, userParams.Email); err != nil {
+			fieldErrs = append(fieldErrs, response.FieldError{Field: "password", Message: err.Error()})
+		}
+	}
+	if len(fieldErrs) > 0 {
+		respondValidationError(w, r, "Invalid email or password", fieldErrs...)
+		return
+	}
+	if fields.Password != nil {
+		userParams.HashedPassword, err = cfg.passwords.Hash(*fields.Password)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Error Hashing Password", err)
+			return
+		}
+	}
+
+	dbUser, err = cfg.db.UpdateUser(r.Context(), userParams)
+	if store.IsUniqueViolation(err) {
+		respondError(w, r, http.StatusConflict, response.CodeConflict, "Email already in use", nil)
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Could not update user", err)
+		return
+	}
+	if fields.Password != nil {
+		// A new password ends every session, including this one.
+		if err := cfg.endSessions(r.Context(), dbUser.ID); err != nil {
+			respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+			return
+		}
+	}
+	user := User{
+		ID:          dbUser.ID,
+		CreatedAt:   dbUser.CreatedAt,
+		UpdatedAt:   dbUser.UpdatedAt,
+		Email:       dbUser.Email,
+		IsChirpyRed: dbUser.IsChirpyRed,
+	}
+	respondJSON(w, http.StatusOK, user)
 }
 
 func (cfg *apiConfig) getChirp(w http.ResponseWriter, r *http.Request) {
 	chirpID := r.PathValue("chirpID")
 	uuidChirp, err := uuid.Parse(chirpID)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(httpError{"Malformed Chirp UUID"})
+		respondValidationError(w, r, "Malformed Chirp UUID", response.FieldError{Field: "chirpID", Message: "must be a UUID"})
 		return
 	}
 	dbChirp, err := cfg.db.GetChirp(r.Context(), uuidChirp)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusNotFound, response.CodeNotFound, fmt.Sprintf("No Chirp by [%s] id found", chirpID), nil)
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(httpError{fmt.Sprintf("No Chirp by [%s] id found", chirpID)})
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
 		return
 	}
 	respChirp := Chirp{
@@ -217,18 +416,180 @@ func (cfg *apiConfig) getChirp(w http.ResponseWriter, r *http.Request) {
 		Body:      dbChirp.Body,
 		UserID:    dbChirp.UserID,
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(respChirp)
+	respondJSON(w, http.StatusOK, respChirp)
+}
+
+// deleteChirp soft-deletes a chirp owned by the caller. The row is kept with
+// deleted_at set so removed content can still be audited.
+func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).User.ID
+
+	chirpID := r.PathValue("chirpID")
+	uuidChirp, err := uuid.Parse(chirpID)
+	if err != nil {
+		respondValidationError(w, r, "Malformed Chirp UUID", response.FieldError{Field: "chirpID", Message: "must be a UUID"})
+		return
+	}
+	dbChirp, err := cfg.db.GetChirp(r.Context(), uuidChirp)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusNotFound, response.CodeNotFound, fmt.Sprintf("No Chirp by [%s] id found", chirpID), nil)
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	if dbChirp.UserID != userID {
+		respondError(w, r, http.StatusForbidden, response.CodeForbidden, "Chirp belongs to another user", nil)
+		return
+	}
+
+	err = cfg.db.DeleteChirp(r.Context(), database.DeleteChirpParams{
+		ID:        dbChirp.ID,
+		DeletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Error Deleting Chirp", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const (
+	defaultChirpPageSize = 50
+	maxChirpPageSize     = 100
+)
+
+type ChirpPage struct {
+	Chirps     []Chirp `json:"chirps"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// chirpListQuery is the parsed form of the GET /api/chirps query string. The
+// ascending and descending list queries take identical parameters, so params
+// is converted to whichever one sortDesc selects.
+type chirpListQuery struct {
+	params   database.ListChirpsAscParams
+	sortDesc bool
+}
+
+// cursorQuery is what a cursor is bound to: everything that decides which
+// rows a page holds, except its size.
+func (q chirpListQuery) cursorQuery() string {
+	bound := func(t sql.NullTime) string {
+		if !t.Valid {
+			return ""
+		}
+		return t.Time.Format(time.RFC3339Nano)
+	}
+	v := url.Values{}
+	v.Set("sort_desc", strconv.FormatBool(q.sortDesc))
+	if q.params.AuthorID.Valid {
+		v.Set("author_id", q.params.AuthorID.UUID.String())
+	}
+	v.Set("since", bound(q.params.Since))
+	v.Set("until", bound(q.params.Until))
+	return v.Encode()
+}
+
+// parseChirpListQuery reads the author_id, sort, since, until, limit and
+// cursor query parameters of GET /api/chirps. Timestamps are RFC 3339.
+func (cfg *apiConfig) parseChirpListQuery(query url.Values) (chirpListQuery, *response.FieldError) {
+	q := chirpListQuery{}
+	q.params.RowLimit = defaultChirpPageSize
+
+	if authorID := query.Get("author_id"); authorID != "" {
+		id, err := uuid.Parse(authorID)
+		if err != nil {
+			return q, &response.FieldError{Field: "author_id", Message: "must be a UUID"}
+		}
+		q.params.AuthorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	switch sort := query.Get("sort"); sort {
+	case "", "asc":
+	case "desc":
+		q.sortDesc = true
+	default:
+		return q, &response.FieldError{Field: "sort", Message: "must be 'asc' or 'desc'"}
+	}
+
+	for _, bound := range []struct {
+		name string
+		dest *sql.NullTime
+	}{
+		{"since", &q.params.Since},
+		{"until", &q.params.Until},
+	} {
+		raw := query.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return q, &response.FieldError{Field: bound.name, Message: "must be an RFC 3339 timestamp"}
+		}
+		*bound.dest = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+	if q.params.Since.Valid && q.params.Until.Valid && q.params.Since.Time.After(q.params.Until.Time) {
+		return q, &response.FieldError{Field: "since", Message: "must not be after until"}
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxChirpPageSize {
+			return q, &response.FieldError{Field: "limit", Message: fmt.Sprintf("must be an integer between 1 and %d", maxChirpPageSize)}
+		}
+		q.params.RowLimit = int32(limit)
+	}
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := pagination.Decode(raw, q.cursorQuery(), cfg.cursorKey)
+		if err != nil {
+			return q, &response.FieldError{Field: "cursor", Message: "is not a cursor issued by this server for this query"}
+		}
+		q.params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		q.params.CursorID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+	return q, nil
 }
 
 func (cfg *apiConfig) getAllChirps(w http.ResponseWriter, r *http.Request) {
-	dbChirps, err := cfg.db.GetAllChirps(r.Context())
+	q, fieldErr := cfg.parseChirpListQuery(r.URL.Query())
+	if fieldErr != nil {
+		respondValidationError(w, r, "Invalid query parameters", *fieldErr)
+		return
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	pageSize := q.params.RowLimit
+	q.params.RowLimit++
+	var (
+		dbChirps []database.Chirp
+		err      error
+	)
+	if q.sortDesc {
+		dbChirps, err = cfg.db.ListChirpsDesc(r.Context(), database.ListChirpsDescParams(q.params))
+	} else {
+		dbChirps, err = cfg.db.ListChirpsAsc(r.Context(), q.params)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(httpError{"Something went wrong"})
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
 		return
 	}
-	respChirps := []Chirp{}
+
+	page := ChirpPage{Chirps: []Chirp{}}
+	if len(dbChirps) > int(pageSize) {
+		dbChirps = dbChirps[:pageSize]
+		last := dbChirps[len(dbChirps)-1]
+		page.NextCursor = pagination.Encode(pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, q.cursorQuery(), cfg.cursorKey)
+
+		next := *r.URL
+		query := next.Query()
+		query.Set("cursor", page.NextCursor)
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
 	for _, dbChirp := range dbChirps {
 		chirp := Chirp{
 			ID:        dbChirp.ID,
@@ -237,10 +598,9 @@ func (cfg *apiConfig) getAllChirps(w http.ResponseWriter, r *http.Request) {
 			Body:      dbChirp.Body,
 			UserID:    dbChirp.UserID,
 		}
-		respChirps = append(respChirps, chirp)
+		page.Chirps = append(page.Chirps, chirp)
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(respChirps)
+	respondJSON(w, http.StatusOK, page)
 }
 
 func (cfg *apiConfig) login(w http.ResponseWriter, r *http.Request) {
@@ -254,71 +614,663 @@ func (cfg *apiConfig) login(w http.ResponseWriter, r *http.Request) {
 	loginReq := loginRequest{}
 	err := json.NewDecoder(r.Body).Decode(&loginReq)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(httpError{"Malformed Request"})
+		respondError(w, r, http.StatusBadRequest, response.CodeMalformedRequest, "Malformed Request", err)
+		return
+	}
+
+	// Unknown emails, wrong passwords and locked accounts all get the same
+	// response after the same hashing work, so none of them reveals whether
+	// an account exists.
+	const badCredentials = "Incorrect email or password"
+	email := validate.NormalizeEmail(loginReq.Email)
+	user, err := cfg.db.GetUserByEmail(r.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) && email != loginReq.Email {
+		// Accounts created before emails were normalized.
+		user, err = cfg.db.GetUserByEmail(r.Context(), loginReq.Email)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.passwords.CheckDummy(loginReq.Password)
+		respondError(w, r, http.StatusUnauthorized, response.CodeInvalidCredentials, badCredentials, nil)
 		return
 	}
-	user, err := cfg.db.GetUserByEmail(r.Context(), loginReq.Email)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(httpError{"User not found by Email"})
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
 		return
 	}
-	if auth.CheckPasswordHash(loginReq.Password, user.HashedPassword) != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(httpError{"Incorrect Password"})
+	logging.SetUserID(r.Context(), user.ID.String())
+	rehash, passwordErr := cfg.passwords.Check(loginReq.Password, user.HashedPassword)
+	if user.LockedUntil.Valid && time.Now().Before(user.LockedUntil.Time) {
+		logging.AddAttrs(r.Context(), slog.Time("locked_until", user.LockedUntil.Time))
+		respondError(w, r, http.StatusUnauthorized, response.CodeInvalidCredentials, badCredentials, nil)
 		return
 	}
-	if loginReq.ExpiresIn == 0 || loginReq.ExpiresIn > 3600 {
-		loginReq.ExpiresIn = 3600
+	if passwordErr != nil {
+		respondError(w, r, http.StatusUnauthorized, response.CodeInvalidCredentials, badCredentials, cfg.recordFailedLogin(r.Context(), user.ID))
+		return
+	}
+	if user.FailedLoginAttempts > 0 || user.LockedUntil.Valid {
+		if _, err := cfg.db.ResetLoginFailures(r.Context(), user.ID); err != nil {
+			respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+			return
+		}
+	}
+	if rehash {
+		// The hash predates the current password_hash settings; a failed
+		// upgrade is retried on the next login.
+		if err := cfg.upgradePasswordHash(r.Context(), user.ID, loginReq.Password); err != nil {
+			logging.AddAttrs(r.Context(), slog.String("rehash_error", err.Error()))
+		}
+	}
+	expiresIn := time.Duration(loginReq.ExpiresIn) * time.Second
+	if expiresIn <= 0 || expiresIn > cfg.accessTokenTTL {
+		expiresIn = cfg.accessTokenTTL
+	}
+
+	token, err := cfg.jwtKeys.Issue(user.ID, user.TokenVersion, auth.TokenUseAccess, expiresIn)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Error generating Auth Token", err)
+		return
 	}
 
-	token, err := auth.MakeJWT(user.ID, cfg.authSecret, time.Duration(loginReq.ExpiresIn)*time.Second)
+	refreshToken, err := cfg.issueRefreshToken(r.Context(), user.ID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(httpError{"Error generating Auth Token"})
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Error generating Refresh Token", err)
 		return
 	}
 
 	userResp := User{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email:     user.Email,
-		Token:     token,
+		ID:           user.ID,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+		Email:        user.Email,
+		IsChirpyRed:  user.IsChirpyRed,
+		Token:        token,
+		RefreshToken: refreshToken,
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(userResp)
+	respondJSON(w, http.StatusOK, userResp)
 }
 
-func main() {
-	err := godotenv.Load()
+// upgradePasswordHash replaces a user's password hash with one made with the
+// current settings.
+func (cfg *apiConfig) upgradePasswordHash(ctx context.Context, userID uuid.UUID, password string) error {
+	hash, err := cfg.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	return cfg.db.UpdatePasswordHash(ctx, database.UpdatePasswordHashParams{ID: userID, HashedPassword: hash})
+}
+
+// recordFailedLogin counts a wrong password. From lockoutThreshold failures
+// on, each one locks the account for lockoutBase, doubled for every failure
+// past the threshold, up to lockoutMax.
+func (cfg *apiConfig) recordFailedLogin(ctx context.Context, userID uuid.UUID) error {
+	attempts, err := cfg.db.RecordFailedLogin(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if int(attempts) < cfg.lockoutThreshold {
+		return nil
+	}
+	delay := cfg.lockoutBase
+	for i := cfg.lockoutThreshold; i < int(attempts) && delay < cfg.lockoutMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, cfg.lockoutMax)
+	return cfg.db.LockUser(ctx, database.LockUserParams{
+		ID:          userID,
+		LockedUntil: sql.NullTime{Time: time.Now().Add(delay), Valid: true},
+	})
+}
+
+// unlockUser clears a user's failed login count and lockout.
+func (cfg *apiConfig) unlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondValidationError(w, r, "Malformed User UUID", response.FieldError{Field: "userID", Message: "must be a UUID"})
+		return
+	}
+	_, err = cfg.db.ResetLoginFailures(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusNotFound, response.CodeNotFound, "User not found", nil)
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) issueRefreshToken(ctx context.Context, userID uuid.UUID) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	timeNow := time.Now()
+	_, err = cfg.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		TokenHash: auth.HashRefreshToken(token),
+		CreatedAt: timeNow,
+		UpdatedAt: timeNow,
+		UserID:    userID,
+		ExpiresAt: timeNow.Add(cfg.refreshTokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// endSessions revokes every access, refresh and personal access token a user
+// holds. Personal access tokens go too: they can be minted with any access
+// token, so one made with a stolen token must not survive its owner locking
+// the thief out.
+func (cfg *apiConfig) endSessions(ctx context.Context, userID uuid.UUID) error {
+	if _, err := cfg.db.BumpTokenVersion(ctx, userID); err != nil {
+		return err
+	}
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	err := cfg.db.RevokeAllRefreshTokensForUser(ctx, database.RevokeAllRefreshTokensForUserParams{
+		UserID:    userID,
+		RevokedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+	return cfg.db.RevokeAllPersonalAccessTokensForUser(ctx, database.RevokeAllPersonalAccessTokensForUserParams{
+		UserID:    userID,
+		RevokedAt: now,
+	})
+}
+
+// logout revokes the access token it is called with and, if one is given,
+// the refresh token issued with it. Revoked access tokens are remembered
+// until they would have expired anyway, and forgotten the next time anyone
+// logs out after that.
+func (cfg *apiConfig) logout(w http.ResponseWriter, r *http.Request) {
+	type logoutRequest struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	defer r.Body.Close()
+
+	principal := auth.MustPrincipal(r.Context())
+	userID, claims := principal.User.ID, principal.Claims
+
+	req := logoutRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, r, http.StatusBadRequest, response.CodeMalformedRequest, "Malformed Request", err)
+		return
+	}
+
+	now := time.Now()
+	if _, err := cfg.db.PruneRevokedAccessTokens(r.Context(), now); err != nil {
+		logging.AddAttrs(r.Context(), slog.String("prune_error", err.Error()))
+	}
+	err := cfg.db.RevokeAccessToken(r.Context(), database.RevokeAccessTokenParams{
+		Jti: claims.ID,
+		// Past this the token fails validation as expired.
+		ExpiresAt: claims.ExpiresAt.Add(cfg.jwtKeys.Policy.Leeway),
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	if req.RefreshToken != "" {
+		hash := auth.HashRefreshToken(req.RefreshToken)
+		stored, err := cfg.db.GetRefreshToken(r.Context(), hash)
+		if err == nil && stored.UserID == userID {
+			_, err = cfg.db.RevokeRefreshToken(r.Context(), database.RevokeRefreshTokenParams{
+				TokenHash: hash,
+				RevokedAt: sql.NullTime{Time: now, Valid: true},
+			})
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutAll ends every session of the calling user on every device.
+func (cfg *apiConfig) logoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).User.ID
+	if err := cfg.endSessions(r.Context(), userID); err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refresh exchanges a refresh token for a new access token. The presented
+// refresh token is revoked and replaced on every use; presenting a token that
+// was already revoked is treated as theft and revokes every refresh token the
+// user holds.
+func (cfg *apiConfig) refresh(w http.ResponseWriter, r *http.Request) {
+	type refreshResponse struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	presented, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondError(w, r, http.StatusUnauthorized, response.CodeUnauthenticated, "Refresh Token Missing", nil)
+		return
+	}
+
+	timeNow := time.Now()
+	hash := auth.HashRefreshToken(presented)
+	revoked, err := cfg.db.RevokeRefreshToken(r.Context(), database.RevokeRefreshTokenParams{
+		TokenHash: hash,
+		RevokedAt: sql.NullTime{Time: timeNow, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		stored, err := cfg.db.GetRefreshToken(r.Context(), hash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+			return
+		}
+		if err == nil && stored.RevokedAt.Valid {
+			err = cfg.db.RevokeAllRefreshTokensForUser(r.Context(), database.RevokeAllRefreshTokensForUserParams{
+				UserID:    stored.UserID,
+				RevokedAt: sql.NullTime{Time: timeNow, Valid: true},
+			})
+			if err != nil {
+				respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+				return
+			}
+		}
+		respondError(w, r, http.StatusUnauthorized, response.CodeInvalidToken, "Invalid Refresh Token", nil)
+		return
+	}
 	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	if timeNow.After(revoked.ExpiresAt) {
+		respondError(w, r, http.StatusUnauthorized, response.CodeInvalidToken, "Refresh Token Expired", nil)
+		return
+	}
+	logging.SetUserID(r.Context(), revoked.UserID.String())
+	user, err := cfg.db.GetUser(r.Context(), revoked.UserID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+
+	token, err := cfg.jwtKeys.Issue(user.ID, user.TokenVersion, auth.TokenUseAccess, cfg.accessTokenTTL)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Error generating Auth Token", err)
+		return
+	}
+	refreshToken, err := cfg.issueRefreshToken(r.Context(), revoked.UserID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Error generating Refresh Token", err)
+		return
+	}
+	respondJSON(w, http.StatusOK, refreshResponse{Token: token, RefreshToken: refreshToken})
+}
+
+func (cfg *apiConfig) revoke(w http.ResponseWriter, r *http.Request) {
+	presented, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondError(w, r, http.StatusUnauthorized, response.CodeUnauthenticated, "Refresh Token Missing", nil)
+		return
+	}
+	_, err = cfg.db.RevokeRefreshToken(r.Context(), database.RevokeRefreshTokenParams{
+		TokenHash: auth.HashRefreshToken(presented),
+		RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PersonalAccessToken is a long-lived token for scripts and bots. The token
+// itself is only returned when it is created; only its hash is stored.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func personalAccessTokenFromDB(t database.PersonalAccessToken) PersonalAccessToken {
+	pat := PersonalAccessToken{
+		ID:        t.ID,
+		Name:      t.Name,
+		Scopes:    auth.SplitScopes(t.Scopes),
+		CreatedAt: t.CreatedAt,
+	}
+	if t.ExpiresAt.Valid {
+		pat.ExpiresAt = &t.ExpiresAt.Time
+	}
+	if t.LastUsedAt.Valid {
+		pat.LastUsedAt = &t.LastUsedAt.Time
+	}
+	return pat
+}
+
+// createPersonalAccessToken issues a personal access token limited to the
+// requested scopes. Tokens outlive logging out of one session, but not
+// logging out everywhere or changing password.
+func (cfg *apiConfig) createPersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	const (
+		maxNameLength    = 100
+		maxExpiresInDays = 3650
+	)
+	type tokenRequest struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	defer r.Body.Close()
+	userID := auth.MustPrincipal(r.Context()).User.ID
+
+	req := tokenRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, http.StatusBadRequest, response.CodeMalformedRequest, "Malformed Request", err)
+		return
+	}
+	var fieldErrs []response.FieldError
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxNameLength {
+		fieldErrs = append(fieldErrs, response.FieldError{Field: "name", Message: fmt.Sprintf("must be 1 to %d characters", maxNameLength)})
+	}
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !slices.Contains(auth.Scopes, scope) {
+			fieldErrs = append(fieldErrs, response.FieldError{Field: "scopes", Message: fmt.Sprintf("unknown scope %q; must be one of %s", scope, strings.Join(auth.Scopes, ", "))})
+			continue
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(req.Scopes) == 0 {
+		fieldErrs = append(fieldErrs, response.FieldError{Field: "scopes", Message: "at least one scope is required"})
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxExpiresInDays {
+		fieldErrs = append(fieldErrs, response.FieldError{Field: "expires_in_days", Message: fmt.Sprintf("must be between 1 and %d; leave it out for a token that does not expire", maxExpiresInDays)})
+	}
+	if len(fieldErrs) > 0 {
+		respondValidationError(w, r, "Invalid personal access token", fieldErrs...)
+		return
+	}
+
+	token, hash, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	now := time.Now().UTC()
+	var expiresAt sql.NullTime
+	if req.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: now.AddDate(0, 0, req.ExpiresInDays), Valid: true}
+	}
+	dbToken, err := cfg.db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hash,
+		Scopes:    auth.JoinScopes(scopes),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	pat := personalAccessTokenFromDB(dbToken)
+	pat.Token = token
+	respondJSON(w, http.StatusCreated, pat)
+}
+
+// listPersonalAccessTokens lists the caller's tokens that have not been
+// revoked, oldest first.
+func (cfg *apiConfig) listPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).User.ID
+	dbTokens, err := cfg.db.ListPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	tokens := make([]PersonalAccessToken, 0, len(dbTokens))
+	for _, t := range dbTokens {
+		tokens = append(tokens, personalAccessTokenFromDB(t))
+	}
+	respondJSON(w, http.StatusOK, tokens)
+}
+
+// revokePersonalAccessToken revokes one of the caller's tokens.
+func (cfg *apiConfig) revokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).User.ID
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		respondValidationError(w, r, "Malformed token UUID", response.FieldError{Field: "tokenID", Message: "must be a UUID"})
+		return
+	}
+	revoked, err := cfg.db.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:        tokenID,
+		UserID:    userID,
+		RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	if revoked == 0 {
+		respondError(w, r, http.StatusNotFound, response.CodeNotFound, "No personal access token by that id found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// polkaWebhook applies subscription events from Polka, our payment provider.
+// Events other than user.upgraded are acknowledged and ignored.
+func (cfg *apiConfig) polkaWebhook(w http.ResponseWriter, r *http.Request) {
+	type webhookRequest struct {
+		Event string `json:"event"`
+		Data  struct {
+			UserID uuid.UUID `json:"user_id"`
+		} `json:"data"`
+	}
+	defer r.Body.Close()
+
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil || cfg.polkaKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaKey)) != 1 {
+		respondError(w, r, http.StatusUnauthorized, response.CodeInvalidCredentials, "Invalid API Key", nil)
+		return
+	}
+
+	webhookReq := webhookRequest{}
+	err = json.NewDecoder(r.Body).Decode(&webhookReq)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, response.CodeMalformedRequest, "Malformed Request", err)
+		return
+	}
+	if webhookReq.Event != "user.upgraded" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	_, err = cfg.db.UpgradeUserToChirpyRed(r.Context(), database.UpgradeUserToChirpyRedParams{
+		ID:        webhookReq.Data.UserID,
+		UpdatedAt: time.Now(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusNotFound, response.CodeNotFound, "User not found", nil)
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, response.CodeInternal, "Something went wrong", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const dbPingTimeout = 5 * time.Second
+
+// openStore connects to the backend named by the store setting. The returned
+// pool is nil for the in-memory store; otherwise the caller closes it.
+func openStore(appConfig config.Config) (store.Store, *sql.DB, error) {
+	switch appConfig.Store {
+	case "memory":
+		return memory.New(), nil, nil
+	case "sqlite":
+		ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+		defer cancel()
+		s, err := sqlite.Open(ctx, appConfig.SQLitePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening sqlite store: %w", err)
+		}
+		return s, s.DB(), nil
+	}
+
+	db, err := openPostgres(appConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	if appConfig.AutoMigrate {
+		results, err := migrate.Up(context.Background(), db)
+		for _, result := range results {
+			slog.Info("Applied migration", "migration", result.Source.Path, "direction", result.Direction, "duration", result.Duration)
+		}
+		if err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("migrating database: %w", err)
+		}
+	}
+	if err := migrate.Check(context.Background(), db); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return database.New(db), db, nil
+}
+
+func openPostgres(appConfig config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", appConfig.DBURL)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	db.SetMaxOpenConns(appConfig.DBMaxOpenConns)
+	db.SetMaxIdleConns(appConfig.DBMaxIdleConns)
+	db.SetConnMaxLifetime(appConfig.DBConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	return db, nil
+}
+
+// runMigrate implements "chirpy migrate up|down|status|redo" against the
+// Postgres database; the sqlite store migrates itself when opened.
+func runMigrate(appConfig config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: chirpy [flags] migrate up|down|status|redo")
+	}
+	if appConfig.Store != "postgres" {
+		return fmt.Errorf("migrate only manages the postgres store, not %q", appConfig.Store)
+	}
+	db, err := openPostgres(appConfig)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return migrate.Run(context.Background(), db, args[0], os.Stdout)
+}
+
+func main() {
+	if err := run(); err != nil {
+		slog.Error("Server failed", "error", err)
 		os.Exit(1)
 	}
+}
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
-	dbQueries := database.New(db)
+// run wires the server together and blocks until it stops. It returns once
+// in-flight requests have drained after SIGINT/SIGTERM, or immediately if the
+// server fails to start.
+func run() error {
+	appConfig, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if appConfig.PrintConfig {
+		fmt.Print(appConfig.Redacted())
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	logger, err := logging.New(os.Stderr, appConfig.LogLevel, appConfig.LogFormat)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
 
-	authSecret := os.Getenv("AUTH_SECRET")
+	if len(appConfig.Args) > 0 {
+		if appConfig.Args[0] != "migrate" {
+			return fmt.Errorf("unknown command %q", appConfig.Args[0])
+		}
+		return runMigrate(appConfig, appConfig.Args[1:])
+	}
+
+	dbStore, db, err := openStore(appConfig)
+	if err != nil {
+		return err
+	}
+	if db != nil {
+		defer db.Close()
+	}
 
-	serveMux := http.NewServeMux()
+	registry := metrics.NewRegistry()
+	if db != nil {
+		metrics.RegisterDBStats(registry, db)
+	}
+
+	handler, err := newServer(appConfig, dbStore, registry, logger)
+	if err != nil {
+		return err
+	}
 	server := http.Server{
-		Handler: serveMux,
-		Addr:    ":8080",
-	}
-
-	cfg := apiConfig{db: dbQueries, authSecret: authSecret}
-	prefixHandler := http.StripPrefix("/app", http.FileServer(http.Dir(".")))
-	serveMux.Handle("/app/", cfg.middlewareMetricsInc(prefixHandler))
-	serveMux.HandleFunc("GET /api/healthz", healthz)
-	serveMux.HandleFunc("GET /admin/metrics", cfg.metrics)
-	serveMux.HandleFunc("POST /admin/reset", cfg.reset)
-	serveMux.HandleFunc("POST /api/chirps", cfg.handlerChirp)
-	serveMux.HandleFunc("POST /api/users", cfg.createUser)
-	serveMux.HandleFunc("GET /api/chirps", cfg.getAllChirps)
-	serveMux.HandleFunc("GET /api/chirps/{chirpID}", cfg.getChirp)
-	serveMux.HandleFunc("POST /api/login", cfg.login)
-	server.ListenAndServe()
+		Handler:           handler,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+		Addr:              appConfig.ListenAddr,
+		ReadHeaderTimeout: appConfig.ReadTimeout,
+		ReadTimeout:       appConfig.ReadTimeout,
+		WriteTimeout:      appConfig.WriteTimeout,
+		IdleTimeout:       appConfig.IdleTimeout,
+		MaxHeaderBytes:    appConfig.MaxHeaderBytes,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Serving", "addr", appConfig.ListenAddr, "platform", appConfig.Platform, "store", appConfig.Store)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("serving on %s: %w", appConfig.ListenAddr, err)
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down, draining in-flight requests", "timeout", appConfig.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), appConfig.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	return nil
 }
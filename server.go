@@ -0,0 +1,135 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/jdwalkerzhere/httpServer/internal/auth"
+	"github.com/jdwalkerzhere/httpServer/internal/config"
+	"github.com/jdwalkerzhere/httpServer/internal/logging"
+	"github.com/jdwalkerzhere/httpServer/internal/metrics"
+	"github.com/jdwalkerzhere/httpServer/internal/pagination"
+	"github.com/jdwalkerzhere/httpServer/internal/ratelimit"
+	"github.com/jdwalkerzhere/httpServer/internal/static"
+	"github.com/jdwalkerzhere/httpServer/internal/store"
+	"github.com/jdwalkerzhere/httpServer/internal/validate"
+)
+
+// staticFiles is the front end served under /app/ unless static_dir points
+// somewhere else.
+//
+//go:embed index.html assets
+var staticFiles embed.FS
+
+// newServer builds the complete API handler: every route, instrumented under
+// its pattern and wrapped in request logging. run serves it over the network;
+// the integration tests drive it directly with httptest. It fails only if
+// the JWT signing keys cannot be loaded.
+func newServer(appConfig config.Config, db store.Store, registry *metrics.Registry, logger *slog.Logger) (http.Handler, error) {
+	cfg := newAPIConfig(registry)
+	cfg.db = db
+	cfg.cursorKey = pagination.DeriveKey(appConfig.AuthSecret)
+	cfg.jwtKeys = auth.NewHMACKeyring(appConfig.AuthSecret)
+	if keyFiles, _ := auth.ParseKeyFiles(appConfig.JWTKeys); len(keyFiles) > 0 {
+		var previous []auth.Key
+		// Config.Validate has already rejected a malformed cutover.
+		if cutover, _ := appConfig.HMACCutover(); !cutover.IsZero() {
+			previous = append(previous, auth.HMACVerifyKey(appConfig.AuthSecret, cutover, appConfig.AccessTokenTTL))
+		}
+		keys, err := auth.LoadKeyring(keyFiles, previous...)
+		if err != nil {
+			return nil, fmt.Errorf("jwt_keys: %w", err)
+		}
+		cfg.jwtKeys = keys
+	}
+	cfg.jwtKeys.Policy = appConfig.TokenPolicy()
+	cfg.authn = auth.NewAuthenticator(cfg.jwtKeys, db)
+	cfg.polkaKey = appConfig.PolkaKey
+	cfg.metricsToken = appConfig.MetricsToken
+	cfg.platform = appConfig.Platform
+	cfg.accessTokenTTL = appConfig.AccessTokenTTL
+	cfg.refreshTokenTTL = appConfig.RefreshTokenTTL
+	cfg.passwordPolicy = validate.PasswordPolicy{
+		MinLength:  appConfig.PasswordMinLength,
+		MinEntropy: appConfig.PasswordMinEntropy,
+	}
+	// Config.Validate has already rejected bad password hash settings.
+	cfg.passwords, _ = auth.NewPasswordHasher(appConfig.PasswordParams())
+	cfg.lockoutThreshold = appConfig.LockoutThreshold
+	cfg.lockoutBase = appConfig.LockoutBase
+	cfg.lockoutMax = appConfig.LockoutMax
+
+	// Config.Validate has already rejected malformed policies.
+	policies, _ := ratelimit.ParsePolicies(appConfig.RateLimits)
+	limiter := ratelimit.New(ratelimit.NewMemory(), policies, cfg.rateLimitKey)
+
+	serveMux := http.NewServeMux()
+	// handle registers every route through the metrics and rate limiting
+	// middleware so each one is counted, timed and limited under its pattern.
+	handle := func(pattern string, handler http.Handler) {
+		serveMux.Handle(pattern, cfg.httpMetrics.Instrument(pattern, limiter.Middleware(pattern, handler)))
+	}
+	// session routes take only access tokens from logging in; scoped routes
+	// also take personal access tokens granted scope.
+	session := func(h http.HandlerFunc) http.Handler {
+		return cfg.authn.Required(cfg.authn.RequireSession(h))
+	}
+	scoped := func(scope string, h http.HandlerFunc) http.Handler {
+		return cfg.authn.Required(cfg.authn.RequireScope(scope, h))
+	}
+	var staticFS fs.FS = staticFiles
+	if appConfig.StaticDir != "" {
+		staticFS = os.DirFS(appConfig.StaticDir)
+	}
+	prefixHandler := http.StripPrefix("/app", static.New(staticFS))
+	handle("GET /app/", cfg.middlewareMetricsInc(prefixHandler))
+	handle("GET /api/healthz", http.HandlerFunc(healthz))
+	handle("GET /.well-known/jwks.json", http.HandlerFunc(cfg.jwks))
+	// Metrics name every route and count logins and failures, so they are
+	// for scrapers with the metrics token and admins unless the deployment
+	// keeps the listener private.
+	if appConfig.MetricsPublic {
+		handle("GET /metrics", registry.Handler())
+	} else {
+		handle("GET /metrics", cfg.middlewareMetricsScraper(registry.Handler()))
+	}
+	handle("GET /admin/metrics", cfg.middlewareAdminOnly(http.HandlerFunc(cfg.metrics)))
+	handle("POST /admin/reset", cfg.middlewareAdminOnly(http.HandlerFunc(cfg.reset)))
+	handle("POST /admin/users/{userID}/unlock", cfg.middlewareAdminOnly(http.HandlerFunc(cfg.unlockUser)))
+	handle("POST /api/chirps", scoped(auth.ScopeChirpsWrite, cfg.handlerChirp))
+	handle("POST /api/users", http.HandlerFunc(cfg.createUser))
+	handle("PUT /api/users", session(cfg.updateUser))
+	handle("GET /api/chirps", http.HandlerFunc(cfg.getAllChirps))
+	handle("GET /api/chirps/{chirpID}", http.HandlerFunc(cfg.getChirp))
+	handle("DELETE /api/chirps/{chirpID}", scoped(auth.ScopeChirpsWrite, cfg.deleteChirp))
+	handle("POST /api/login", http.HandlerFunc(cfg.login))
+	handle("POST /api/refresh", http.HandlerFunc(cfg.refresh))
+	handle("POST /api/revoke", http.HandlerFunc(cfg.revoke))
+	handle("POST /api/logout", session(cfg.logout))
+	handle("POST /api/logout-all", session(cfg.logoutAll))
+	handle("POST /api/tokens", session(cfg.createPersonalAccessToken))
+	handle("GET /api/tokens", session(cfg.listPersonalAccessTokens))
+	handle("DELETE /api/tokens/{tokenID}", session(cfg.revokePersonalAccessToken))
+	handle("POST /api/polka/webhooks", http.HandlerFunc(cfg.polkaWebhook))
+
+	return logging.Middleware(logger, serveMux), nil
+}
+
+// rateLimitKey charges requests with a validly signed access token to its
+// user, so they share one bucket across addresses, and everything else,
+// personal access tokens included, to the client IP. It only checks the
+// signature and never touches the store, since the limiter runs before
+// anything else and must stay cheap for floods of bogus tokens. A revoked
+// token still counts against its user, which only spends that user's bucket.
+func (c *apiConfig) rateLimitKey(r *http.Request) string {
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		if id, err := c.jwtKeys.ValidateJWT(token); err == nil {
+			return "user:" + id.String()
+		}
+	}
+	return "ip:" + ratelimit.ClientIP(r)
+}
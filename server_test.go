@@ -0,0 +1,933 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jdwalkerzhere/httpServer/internal/auth"
+	"github.com/jdwalkerzhere/httpServer/internal/config"
+	"github.com/jdwalkerzhere/httpServer/internal/database"
+	"github.com/jdwalkerzhere/httpServer/internal/metrics"
+	"github.com/jdwalkerzhere/httpServer/internal/store"
+	"github.com/jdwalkerzhere/httpServer/internal/store/memory"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+const (
+	testAuthSecret = "integration-test-secret-0123456789abcdef"
+	testPolkaKey   = "integration-test-polka-key"
+)
+
+// adminStore grants the admin role to chosen users. The API has no endpoint
+// for that; in production it is set directly in the database. It can also
+// fail revoking every refresh token of a user, to test reuse detection, and
+// counts the lookups authenticating a request makes.
+type adminStore struct {
+	store.Store
+	admins       map[uuid.UUID]bool
+	revokeAllErr error
+	authLookups  int
+}
+
+func (s *adminStore) GetAccessTokenRevocation(ctx context.Context, arg database.GetAccessTokenRevocationParams) (database.GetAccessTokenRevocationRow, error) {
+	s.authLookups++
+	return s.Store.GetAccessTokenRevocation(ctx, arg)
+}
+
+func (s *adminStore) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	s.authLookups++
+	return s.Store.GetPersonalAccessTokenByHash(ctx, tokenHash)
+}
+
+func (s *adminStore) RevokeAllRefreshTokensForUser(ctx context.Context, arg database.RevokeAllRefreshTokensForUserParams) error {
+	if s.revokeAllErr != nil {
+		return s.revokeAllErr
+	}
+	return s.Store.RevokeAllRefreshTokensForUser(ctx, arg)
+}
+
+func (s *adminStore) GetUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.authLookups++
+	u, err := s.Store.GetUser(ctx, id)
+	u.IsAdmin = u.IsAdmin || s.admins[id]
+	return u, err
+}
+
+// testServer is the real handler from newServer backed by a fresh in-memory
+// store.
+type testServer struct {
+	t       *testing.T
+	handler http.Handler
+	store   *adminStore
+
+	// uuids maps every UUID seen in a response to a stable placeholder, so
+	// golden files can show which IDs refer to the same thing.
+	uuids map[string]string
+}
+
+// newTestServer starts from the default config; configure may adjust it
+// further.
+func newTestServer(t *testing.T, platform string, configure ...func(*config.Config)) *testServer {
+	t.Helper()
+	appConfig := config.Default()
+	appConfig.Store = "memory"
+	appConfig.AuthSecret = testAuthSecret
+	appConfig.PolkaKey = testPolkaKey
+	appConfig.Platform = platform
+	for _, f := range configure {
+		f(&appConfig)
+	}
+	if err := appConfig.Validate(); err != nil {
+		t.Fatalf("Expected valid test config, got: %v", err)
+	}
+
+	db := &adminStore{Store: memory.New(), admins: map[uuid.UUID]bool{}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler, err := newServer(appConfig, db, metrics.NewRegistry(), logger)
+	if err != nil {
+		t.Fatalf("Expected no error building the server, got: %v", err)
+	}
+	return &testServer{
+		t:       t,
+		handler: handler,
+		store:   db,
+		uuids:   map[string]string{},
+	}
+}
+
+// request builds a request with body encoded as JSON, or sent verbatim if it
+// is a string.
+func (s *testServer) request(method, path, token string, body any) *http.Request {
+	s.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatalf("Expected no error encoding request, got: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func (s *testServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *testServer) do(method, path, token string, body any) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.serve(s.request(method, path, token, body))
+}
+
+// decode unmarshals a JSON response into v, failing on an unexpected status.
+func (s *testServer) decode(rec *httptest.ResponseRecorder, status int, v any) {
+	s.t.Helper()
+	if rec.Code != status {
+		s.t.Fatalf("Expected status %d, got %d: %s", status, rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		s.t.Fatalf("Expected JSON response, got %q: %v", rec.Body.String(), err)
+	}
+}
+
+func (s *testServer) signup(email, password string) User {
+	s.t.Helper()
+	var user User
+	s.decode(s.do(http.MethodPost, "/api/users", "", map[string]string{"email": email, "password": password}), http.StatusCreated, &user)
+	return user
+}
+
+func (s *testServer) login(email, password string) User {
+	s.t.Helper()
+	var user User
+	s.decode(s.do(http.MethodPost, "/api/login", "", map[string]string{"email": email, "password": password}), http.StatusOK, &user)
+	return user
+}
+
+func (s *testServer) chirp(token, body string) Chirp {
+	s.t.Helper()
+	var chirp Chirp
+	s.decode(s.do(http.MethodPost, "/api/chirps", token, map[string]string{"body": body}), http.StatusCreated, &chirp)
+	return chirp
+}
+
+var uuidPattern = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// scrub replaces the parts of a response that change from run to run:
+// UUIDs anywhere become numbered placeholders, and timestamps, tokens and
+// cursors become fixed markers when present.
+func (s *testServer) scrub(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		// Visit keys in order so placeholders are numbered deterministically.
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := v[key]
+			str, ok := value.(string)
+			switch {
+			case !ok || str == "":
+				v[key] = s.scrub(value)
+			case key == "created_at" || key == "updated_at" || key == "expires_at" || key == "last_used_at":
+				v[key] = "<timestamp>"
+			case key == "token" && strings.HasPrefix(str, auth.PersonalTokenPrefix):
+				v[key] = "<personal-access-token>"
+			case key == "token":
+				v[key] = "<jwt>"
+			case key == "refresh_token":
+				v[key] = "<refresh-token>"
+			case key == "next_cursor":
+				v[key] = "<cursor>"
+			default:
+				v[key] = s.scrub(value)
+			}
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = s.scrub(v[i])
+		}
+		return v
+	case string:
+		return uuidPattern.ReplaceAllStringFunc(v, func(id string) string {
+			if _, ok := s.uuids[id]; !ok {
+				s.uuids[id] = fmt.Sprintf("<uuid-%d>", len(s.uuids)+1)
+			}
+			return s.uuids[id]
+		})
+	default:
+		return v
+	}
+}
+
+// golden compares the response's status, content type and scrubbed body with
+// testdata/golden/<name>.json. Run with -update to rewrite it.
+func (s *testServer) golden(name string, rec *httptest.ResponseRecorder) {
+	s.t.Helper()
+	var body any
+	if rec.Body.Len() > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(rec.Body.Bytes()))
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			s.t.Fatalf("%s: expected a JSON body, got: %v", name, err)
+		}
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(map[string]any{
+		"status":       rec.Code,
+		"content_type": rec.Header().Get("Content-Type"),
+		"body":         s.scrub(body),
+	})
+	if err != nil {
+		s.t.Fatalf("%s: expected no error encoding golden, got: %v", name, err)
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			s.t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			s.t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		s.t.Fatalf("%s: reading golden file (run go test -update to create it): %v", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		s.t.Errorf("%s: response does not match %s\ngot:\n%s\nwant:\n%s", name, path, got, want)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	s := newTestServer(t, "prod")
+
+	rec := s.do(http.MethodGet, "/api/healthz", "", nil)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "OK" {
+		t.Errorf("Expected 200 OK, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSignupLoginChirpFlow(t *testing.T) {
+	s := newTestServer(t, "prod")
+
+	s.golden("signup", s.do(http.MethodPost, "/api/users", "", map[string]string{"email": "saul@bettercall.com", "password": "S0 it's all good, man"}))
+	s.golden("signup_duplicate", s.do(http.MethodPost, "/api/users", "", map[string]string{"email": " Saul@BetterCall.com", "password": "Slippin' Jimmy 1960"}))
+
+	rec := s.do(http.MethodPost, "/api/login", "", map[string]string{"email": "saul@bettercall.com", "password": "S0 it's all good, man"})
+	s.golden("login", rec)
+	var saul User
+	if err := json.Unmarshal(rec.Body.Bytes(), &saul); err != nil {
+		t.Fatalf("Expected login JSON, got: %v", err)
+	}
+
+	first := s.do(http.MethodPost, "/api/chirps", saul.Token, map[string]string{"body": "I had a kerfuffle with a Sharbert today"})
+	s.golden("chirp_create", first)
+	s.chirp(saul.Token, "Second chirp")
+
+	var created Chirp
+	if err := json.Unmarshal(first.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Expected chirp JSON, got: %v", err)
+	}
+	s.golden("chirp_get", s.do(http.MethodGet, "/api/chirps/"+created.ID.String(), "", nil))
+	s.golden("chirps_list", s.do(http.MethodGet, "/api/chirps", "", nil))
+
+	page := s.do(http.MethodGet, "/api/chirps?author_id="+saul.ID.String()+"&sort=desc&limit=1", "", nil)
+	s.golden("chirps_list_page", page)
+	var firstPage ChirpPage
+	s.decode(page, http.StatusOK, &firstPage)
+	if link := page.Header().Get("Link"); !strings.Contains(link, `rel="next"`) {
+		t.Errorf("Expected a next Link header, got: %q", link)
+	}
+	var secondPage ChirpPage
+	s.decode(s.do(http.MethodGet, "/api/chirps?author_id="+saul.ID.String()+"&sort=desc&limit=1&cursor="+firstPage.NextCursor, "", nil), http.StatusOK, &secondPage)
+	if len(secondPage.Chirps) != 1 || secondPage.Chirps[0].ID != created.ID || secondPage.NextCursor != "" {
+		t.Errorf("Expected the second page to hold only the first chirp, got: %+v", secondPage)
+	}
+	// A cursor only continues the query it came from.
+	for _, query := range []string{"sort=asc", "sort=desc", "author_id=" + uuid.NewString() + "&sort=desc", "author_id=" + saul.ID.String() + "&sort=desc&since=2000-01-01T00:00:00Z"} {
+		if rec := s.do(http.MethodGet, "/api/chirps?"+query+"&cursor="+firstPage.NextCursor, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected the cursor to be refused with %s, got: %d", query, rec.Code)
+		}
+	}
+
+	s.golden("user_update", s.do(http.MethodPut, "/api/users", saul.Token, map[string]string{"email": "Saul@Goodman.com"}))
+	s.login("SAUL@goodman.com", "S0 it's all good, man")
+
+	rec = s.do(http.MethodDelete, "/api/chirps/"+created.ID.String(), saul.Token, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 deleting own chirp, got %d: %s", rec.Code, rec.Body.String())
+	}
+	s.golden("chirp_get_deleted", s.do(http.MethodGet, "/api/chirps/"+created.ID.String(), "", nil))
+	s.golden("chirp_delete_deleted", s.do(http.MethodDelete, "/api/chirps/"+created.ID.String(), saul.Token, nil))
+	s.golden("chirp_delete_missing", s.do(http.MethodDelete, "/api/chirps/"+uuid.NewString(), saul.Token, nil))
+}
+
+func TestRefreshAndRevoke(t *testing.T) {
+	s := newTestServer(t, "prod")
+	s.signup("walt@heisenberg.com", "Blue sky, 99.1% pure")
+	walt := s.login("walt@heisenberg.com", "Blue sky, 99.1% pure")
+	if _, err := s.store.GetRefreshToken(context.Background(), walt.RefreshToken); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected refresh tokens to be stored hashed, got: %v", err)
+	}
+
+	var refreshed struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	rec := s.do(http.MethodPost, "/api/refresh", walt.RefreshToken, nil)
+	s.decode(rec, http.StatusOK, &refreshed)
+	s.chirp(refreshed.Token, "Say my name")
+
+	s.golden("refresh_reused", s.do(http.MethodPost, "/api/refresh", walt.RefreshToken, nil))
+	s.golden("refresh_after_reuse", s.do(http.MethodPost, "/api/refresh", refreshed.RefreshToken, nil))
+
+	other := s.login("walt@heisenberg.com", "Blue sky, 99.1% pure")
+	if rec := s.do(http.MethodPost, "/api/revoke", other.RefreshToken, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 revoking, got %d: %s", rec.Code, rec.Body.String())
+	}
+	s.golden("refresh_revoked", s.do(http.MethodPost, "/api/refresh", other.RefreshToken, nil))
+
+	// Reuse must not be reported as handled unless the revocation stuck.
+	s.store.revokeAllErr = errors.New("database is down")
+	if rec := s.do(http.MethodPost, "/api/refresh", other.RefreshToken, nil); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 when revoking a reused token's family fails, got: %d", rec.Code)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	s := newTestServer(t, "prod")
+	s.signup("gale@boetticher.com", "Crystal purity 96.2 percent")
+	laptop := s.login("gale@boetticher.com", "Crystal purity 96.2 percent")
+	phone := s.login("gale@boetticher.com", "Crystal purity 96.2 percent")
+
+	logout := s.do(http.MethodPost, "/api/logout", laptop.Token, map[string]string{"refresh_token": laptop.RefreshToken})
+	if logout.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 logging out, got %d: %s", logout.Code, logout.Body.String())
+	}
+	s.golden("logout_revoked_token", s.do(http.MethodPost, "/api/chirps", laptop.Token, map[string]string{"body": "hi"}))
+	if rec := s.do(http.MethodPost, "/api/refresh", laptop.RefreshToken, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the refresh token to be revoked with it, got: %d", rec.Code)
+	}
+	s.chirp(phone.Token, "Still logged in on my phone")
+
+	if rec := s.do(http.MethodPost, "/api/logout-all", phone.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 logging out everywhere, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodPost, "/api/chirps", phone.Token, map[string]string{"body": "hi"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the phone's access token to be revoked, got: %d", rec.Code)
+	}
+	if rec := s.do(http.MethodPost, "/api/refresh", phone.RefreshToken, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the phone's refresh token to be revoked, got: %d", rec.Code)
+	}
+
+	desktop := s.login("gale@boetticher.com", "Crystal purity 96.2 percent")
+	s.chirp(desktop.Token, "Logged back in")
+	var refreshed struct {
+		Token string `json:"token"`
+	}
+	s.decode(s.do(http.MethodPost, "/api/refresh", desktop.RefreshToken, nil), http.StatusOK, &refreshed)
+
+	rec := s.do(http.MethodPut, "/api/users", desktop.Token, map[string]string{"password": "Lab notebook, page 47"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 changing password, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for name, token := range map[string]string{"desktop": desktop.Token, "refreshed": refreshed.Token} {
+		if rec := s.do(http.MethodPost, "/api/chirps", token, map[string]string{"body": "hi"}); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the %s token to die with the old password, got: %d", name, rec.Code)
+		}
+	}
+	s.chirp(s.login("gale@boetticher.com", "Lab notebook, page 47").Token, "New password, who dis")
+
+	for _, path := range []string{"/api/logout", "/api/logout-all"} {
+		if rec := s.do(http.MethodPost, path, "", nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s to require a token, got: %d", path, rec.Code)
+		}
+	}
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	s := newTestServer(t, "prod")
+	s.signup("badger@mayhew.com", "Star Trek pitch, scene one")
+	session := s.login("badger@mayhew.com", "Star Trek pitch, scene one").Token
+
+	create := func(body map[string]any) *httptest.ResponseRecorder {
+		return s.do(http.MethodPost, "/api/tokens", session, body)
+	}
+	rec := create(map[string]any{"name": "chirp bot", "scopes": []string{"chirps:write", "chirps:write"}, "expires_in_days": 30})
+	s.golden("pat_create", rec)
+	var bot struct {
+		ID    uuid.UUID `json:"id"`
+		Token string    `json:"token"`
+	}
+	s.decode(rec, http.StatusCreated, &bot)
+	var reader struct {
+		Token string `json:"token"`
+	}
+	s.decode(create(map[string]any{"name": "reader", "scopes": []string{"chirps:read"}}), http.StatusCreated, &reader)
+	s.golden("pat_create_invalid", create(map[string]any{"name": " ", "scopes": []string{"chirps:delete"}, "expires_in_days": -1}))
+	if rec := create(map[string]any{"name": "forever", "scopes": []string{"chirps:read"}, "expires_in_days": 1_000_000}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an expiry past the maximum to be refused, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The bot can chirp without ever knowing the password.
+	chirp := s.chirp(bot.Token, "Posted by a bot")
+	s.golden("pat_missing_scope", s.do(http.MethodPost, "/api/chirps", reader.Token, map[string]string{"body": "hi"}))
+	// Email and password are credentials, so even profile:write cannot
+	// change them: a leaked token must not become the account.
+	var profile struct {
+		Token string `json:"token"`
+	}
+	s.decode(create(map[string]any{"name": "profile", "scopes": []string{"profile:write"}}), http.StatusCreated, &profile)
+	s.golden("pat_change_password", s.do(http.MethodPut, "/api/users", profile.Token, map[string]string{"password": "Hijacked by a leaked token"}))
+	if rec := s.do(http.MethodPut, "/api/users", profile.Token, map[string]string{"email": "bot@mayhew.com"}); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a personal access token to be refused an email change, got: %d", rec.Code)
+	}
+	if rec := s.do(http.MethodPost, "/api/login", "", map[string]string{"email": "badger@mayhew.com", "password": "Hijacked by a leaked token"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the password to be unchanged, got: %d", rec.Code)
+	}
+	// Chirps are public, so reading them needs no scope.
+	for _, path := range []string{"/api/chirps", "/api/chirps/" + chirp.ID.String()} {
+		if rec := s.do(http.MethodGet, path, bot.Token, nil); rec.Code != http.StatusOK {
+			t.Errorf("Expected GET %s to work without chirps:read, got: %d", path, rec.Code)
+		}
+	}
+	// Tokens cannot mint more tokens or end sessions.
+	s.golden("pat_session_only", s.do(http.MethodPost, "/api/tokens", bot.Token, map[string]any{"name": "more", "scopes": []string{"chirps:write"}}))
+	if rec := s.do(http.MethodPost, "/api/logout-all", bot.Token, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected logout-all to refuse a personal access token, got: %d", rec.Code)
+	}
+
+	s.golden("pat_list", s.do(http.MethodGet, "/api/tokens", session, nil))
+	if rec := s.do(http.MethodDelete, "/api/tokens/"+bot.ID.String(), session, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 revoking the token, got %d: %s", rec.Code, rec.Body.String())
+	}
+	s.golden("pat_revoked", s.do(http.MethodPost, "/api/chirps", bot.Token, map[string]string{"body": "hi"}))
+	s.golden("pat_revoke_twice", s.do(http.MethodDelete, "/api/tokens/"+bot.ID.String(), session, nil))
+
+	// Logging out everywhere takes personal access tokens with it, so one
+	// minted with a stolen access token does not outlive the session.
+	if rec := s.do(http.MethodPost, "/api/logout-all", session, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 logging out everywhere, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodPost, "/api/chirps", reader.Token, map[string]string{"body": "hi"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected logging out everywhere to revoke personal access tokens, got: %d", rec.Code)
+	}
+	session = s.login("badger@mayhew.com", "Star Trek pitch, scene one").Token
+	if rec := s.do(http.MethodGet, "/api/tokens", session, nil); rec.Body.String() != "[]\n" {
+		t.Errorf("Expected no tokens left after logging out everywhere, got: %s", rec.Body.String())
+	}
+
+	s.signup("saul@bettercall.com", "S0 it's all good, man")
+	other := s.login("saul@bettercall.com", "S0 it's all good, man").Token
+	var list []map[string]any
+	s.decode(s.do(http.MethodGet, "/api/tokens", other, nil), http.StatusOK, &list)
+	if len(list) != 0 {
+		t.Errorf("Expected another user to see none of these tokens, got: %v", list)
+	}
+}
+
+func TestAuthFailures(t *testing.T) {
+	s := newTestServer(t, "prod")
+	user := s.signup("jesse@pinkman.com", "Magnets, yo!")
+	token := s.login("jesse@pinkman.com", "Magnets, yo!").Token
+	chirp := s.chirp(token, "Science")
+	s.signup("mike@ehrmantraut.com", "No half measures, Walter")
+	mikeToken := s.login("mike@ehrmantraut.com", "No half measures, Walter").Token
+	keys := auth.NewHMACKeyring(testAuthSecret)
+	expired, _ := keys.Issue(user.ID, 0, auth.TokenUseAccess, -time.Hour)
+	resetToken, _ := keys.Issue(user.ID, 0, auth.TokenUsePasswordReset, time.Hour)
+	keys.Policy.Audience = "billing-api"
+	otherAudience, _ := keys.Issue(user.ID, 0, auth.TokenUseAccess, time.Hour)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+	}{
+		{"chirp_no_token", http.MethodPost, "/api/chirps", "", map[string]string{"body": "hi"}},
+		{"chirp_bad_token", http.MethodPost, "/api/chirps", "not-a-jwt", map[string]string{"body": "hi"}},
+		{"chirp_wrong_secret", http.MethodPost, "/api/chirps", signedWith(t, user.ID, "some-other-secret-0123456789abcdef"), map[string]string{"body": "hi"}},
+		{"chirp_expired_token", http.MethodPost, "/api/chirps", expired, map[string]string{"body": "hi"}},
+		{"chirp_wrong_audience", http.MethodPost, "/api/chirps", otherAudience, map[string]string{"body": "hi"}},
+		{"chirp_password_reset_token", http.MethodPost, "/api/chirps", resetToken, map[string]string{"body": "hi"}},
+		{"update_user_no_token", http.MethodPut, "/api/users", "", map[string]string{"email": "x@y.z"}},
+		{"delete_chirp_not_owner", http.MethodDelete, "/api/chirps/" + chirp.ID.String(), mikeToken, nil},
+		{"login_wrong_password", http.MethodPost, "/api/login", "", map[string]string{"email": "jesse@pinkman.com", "password": "nope"}},
+		{"login_unknown_email", http.MethodPost, "/api/login", "", map[string]string{"email": "gus@pollos.com", "password": "Magnets, yo!"}},
+		{"refresh_unknown", http.MethodPost, "/api/refresh", "deadbeef", nil},
+		{"refresh_no_token", http.MethodPost, "/api/refresh", "", nil},
+	}
+	for _, tt := range tests {
+		s.golden("auth_"+tt.name, s.do(tt.method, tt.path, tt.token, tt.body))
+	}
+
+	// Every route behind the auth middleware challenges the same way.
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/api/chirps"},
+		{http.MethodPut, "/api/users"},
+		{http.MethodDelete, "/api/chirps/" + chirp.ID.String()},
+		{http.MethodPost, "/api/logout"},
+		{http.MethodPost, "/api/logout-all"},
+		{http.MethodGet, "/admin/metrics"},
+	} {
+		if got := s.do(route.method, route.path, "", nil).Header().Get("WWW-Authenticate"); got != `Bearer realm="chirpy"` {
+			t.Errorf("%s %s: expected a bearer challenge, got: %q", route.method, route.path, got)
+		}
+		want := `Bearer realm="chirpy", error="invalid_token", error_description="Token has expired"`
+		if got := s.do(route.method, route.path, expired, nil).Header().Get("WWW-Authenticate"); got != want {
+			t.Errorf("%s %s: expected %q, got: %q", route.method, route.path, want, got)
+		}
+	}
+}
+
+func signedWith(t *testing.T, userID uuid.UUID, secret string) string {
+	t.Helper()
+	token, err := auth.MakeJWT(userID, secret, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error signing token, got: %v", err)
+	}
+	return token
+}
+
+func TestValidationErrors(t *testing.T) {
+	s := newTestServer(t, "prod")
+	s.signup("skyler@white.com", "A1A Car Wash, Albuquerque")
+	token := s.login("skyler@white.com", "A1A Car Wash, Albuquerque").Token
+	s.signup("marie@schrader.com", "Purple is my color #7")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+	}{
+		{"chirp_too_long", http.MethodPost, "/api/chirps", token, map[string]string{"body": strings.Repeat("a", 141)}},
+		{"chirp_malformed", http.MethodPost, "/api/chirps", token, `{"body":`},
+		{"signup_malformed", http.MethodPost, "/api/users", "", `not json`},
+		{"update_user_empty", http.MethodPut, "/api/users", token, map[string]string{}},
+		{"update_user_blank_fields", http.MethodPut, "/api/users", token, map[string]string{"email": "", "password": ""}},
+		{"update_user_email_taken", http.MethodPut, "/api/users", token, map[string]string{"email": "Marie@Schrader.com"}},
+		{"signup_bad_email", http.MethodPost, "/api/users", "", map[string]string{"email": "walt at graymatter", "password": "Gray Matter Technologies"}},
+		{"signup_short_password", http.MethodPost, "/api/users", "", map[string]string{"email": "walt@graymatter.com", "password": "Gr4y!"}},
+		{"signup_common_password", http.MethodPost, "/api/users", "", map[string]string{"email": "walt@graymatter.com", "password": "password1"}},
+		{"signup_password_contains_email", http.MethodPost, "/api/users", "", map[string]string{"email": "walt@graymatter.com", "password": "walt's new password"}},
+		{"signup_weak_password", http.MethodPost, "/api/users", "", map[string]string{"email": "walt@graymatter.com", "password": "aaaaaaaaaaaa"}},
+		{"chirp_get_bad_id", http.MethodGet, "/api/chirps/not-a-uuid", "", nil},
+		{"chirp_get_missing", http.MethodGet, "/api/chirps/00000000-0000-0000-0000-000000000000", "", nil},
+		{"chirps_list_bad_limit", http.MethodGet, "/api/chirps?limit=500", "", nil},
+		{"chirps_list_bad_sort", http.MethodGet, "/api/chirps?sort=sideways", "", nil},
+		{"chirps_list_bad_cursor", http.MethodGet, "/api/chirps?cursor=forged", "", nil},
+		{"chirps_list_inverted_range", http.MethodGet, "/api/chirps?since=2024-02-01T00:00:00Z&until=2024-01-01T00:00:00Z", "", nil},
+	}
+	for _, tt := range tests {
+		s.golden("validation_"+tt.name, s.do(tt.method, tt.path, tt.token, tt.body))
+	}
+
+	req := s.request(http.MethodPost, "/api/chirps", token, map[string]string{"body": strings.Repeat("a", 141)})
+	req.Header.Set("Accept", "application/problem+json")
+	s.golden("validation_chirp_too_long_problem", s.serve(req))
+}
+
+func TestAdminGating(t *testing.T) {
+	s := newTestServer(t, "dev")
+	hank := s.signup("hank@dea.gov", "They're minerals, Marie!")
+	s.store.admins[hank.ID] = true
+	adminToken := s.login("hank@dea.gov", "They're minerals, Marie!").Token
+	s.signup("marie@schrader.com", "Purple is my color #7")
+	userToken := s.login("marie@schrader.com", "Purple is my color #7").Token
+
+	s.golden("admin_metrics_no_token", s.do(http.MethodGet, "/admin/metrics", "", nil))
+	s.golden("admin_metrics_not_admin", s.do(http.MethodGet, "/admin/metrics", userToken, nil))
+	s.golden("admin_reset_not_admin", s.do(http.MethodPost, "/admin/reset", userToken, nil))
+	for name, token := range map[string]string{"anonymous": "", "non-admin": userToken} {
+		if rec := s.do(http.MethodGet, "/metrics", token, nil); rec.Code != http.StatusUnauthorized && rec.Code != http.StatusForbidden {
+			t.Errorf("Expected /metrics to be refused to a %s request, got: %d", name, rec.Code)
+		}
+	}
+	public := newTestServer(t, "prod", func(c *config.Config) { c.MetricsPublic = true })
+	if rec := public.do(http.MethodGet, "/metrics", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected /metrics to be public with metrics_public set, got: %d", rec.Code)
+	}
+	scraped := newTestServer(t, "prod", func(c *config.Config) { c.MetricsToken = "prometheus-scrape-token" })
+	if rec := scraped.do(http.MethodGet, "/metrics", "prometheus-scrape-token", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected the metrics token to read /metrics, got: %d", rec.Code)
+	}
+	if rec := scraped.do(http.MethodGet, "/metrics", "prometheus-scrape-guess", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong metrics token to be refused, got: %d", rec.Code)
+	}
+
+	rec := s.do(http.MethodGet, "/admin/metrics", adminToken, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for an admin, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "Welcome, Chirpy Admin") || !strings.Contains(body, "2 users and 0 chirps created") {
+		t.Errorf("Unexpected admin metrics page: %s", body)
+	}
+
+	if rec := s.do(http.MethodPost, "/admin/reset", adminToken, nil); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 resetting in dev, got %d: %s", rec.Code, rec.Body.String())
+	}
+	s.golden("admin_reset_then_login", s.do(http.MethodPost, "/api/login", "", map[string]string{"email": "marie@schrader.com", "password": "Purple is my color #7"}))
+}
+
+func TestAdminResetForbiddenOutsideDev(t *testing.T) {
+	s := newTestServer(t, "prod")
+	admin := s.signup("gus@pollos.com", "Los Pollos Hermanos 1986")
+	s.store.admins[admin.ID] = true
+	token := s.login("gus@pollos.com", "Los Pollos Hermanos 1986").Token
+
+	s.golden("admin_reset_prod", s.do(http.MethodPost, "/admin/reset", token, nil))
+	s.login("gus@pollos.com", "Los Pollos Hermanos 1986")
+}
+
+func TestPolkaWebhook(t *testing.T) {
+	s := newTestServer(t, "prod")
+	user := s.signup("lydia@madrigal.com", "Stevia in my chamomile 2")
+	token := s.login("lydia@madrigal.com", "Stevia in my chamomile 2").Token
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": user.ID.String()}}
+
+	// Limits count characters, not bytes: each of these is three or four.
+	s.chirp(token, strings.Repeat("界", 140))
+	if rec := s.do(http.MethodPost, "/api/chirps", token, map[string]string{"body": strings.Repeat("🐦", 141)}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 141 characters to be too long, got: %d", rec.Code)
+	}
+
+	webhook := func(key string, body any) *httptest.ResponseRecorder {
+		req := s.request(http.MethodPost, "/api/polka/webhooks", "", body)
+		if key != "" {
+			req.Header.Set("Authorization", "ApiKey "+key)
+		}
+		return s.serve(req)
+	}
+
+	s.golden("polka_no_key", webhook("", upgrade))
+	s.golden("polka_wrong_key", webhook("not-the-key", upgrade))
+	s.golden("polka_unknown_user", webhook(testPolkaKey, map[string]any{
+		"event": "user.upgraded",
+		"data":  map[string]string{"user_id": "00000000-0000-0000-0000-000000000000"},
+	}))
+
+	if rec := webhook(testPolkaKey, upgrade); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 upgrading, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !s.login("lydia@madrigal.com", "Stevia in my chamomile 2").IsChirpyRed {
+		t.Error("Expected user to be Chirpy Red after the webhook")
+	}
+	s.chirp(token, strings.Repeat("a", 280))
+	s.chirp(token, strings.Repeat("🐦", 280))
+	if rec := s.do(http.MethodPost, "/api/chirps", token, map[string]string{"body": strings.Repeat("界", 281)}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 281 characters to be too long for Chirpy Red, got: %d", rec.Code)
+	}
+}
+
+func TestStaticFiles(t *testing.T) {
+	s := newTestServer(t, "prod")
+
+	rec := s.do(http.MethodGet, "/app/", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Welcome to Chirpy") {
+		t.Errorf("Expected the embedded index.html, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodGet, "/app/assets/logo.png", "", nil); rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected the embedded logo, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, path := range []string{"/app/.env", "/app/main.go", "/app/go.mod"} {
+		if rec := s.do(http.MethodGet, path, "", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected %s to be hidden, got %d", path, rec.Code)
+		}
+	}
+
+	admin := s.signup("gus@pollos.com", "Los Pollos Hermanos 1986")
+	s.store.admins[admin.ID] = true
+	rec = s.do(http.MethodGet, "/metrics", s.login("gus@pollos.com", "Los Pollos Hermanos 1986").Token, nil)
+	if !strings.Contains(rec.Body.String(), "chirpy_fileserver_hits_total 5\n") {
+		t.Errorf("Expected every /app/ request to be counted, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestRateLimiting(t *testing.T) {
+	s := newTestServer(t, "prod", func(c *config.Config) {
+		c.RateLimits = "POST /api/login=2/1m; POST /api/chirps=1/1m"
+	})
+	s.signup("todd@vamonos.com", "Tarantula in a jar, 2009")
+	kenny := s.signup("kenny@vamonos.com", "Vamonos Pest Control!")
+
+	token := s.login("todd@vamonos.com", "Tarantula in a jar, 2009").Token
+	s.login("kenny@vamonos.com", "Vamonos Pest Control!")
+	rec := s.do(http.MethodPost, "/api/login", "", map[string]string{"email": "todd@vamonos.com", "password": "Tarantula in a jar, 2009"})
+	s.golden("rate_limited_login", rec)
+	if rec.Header().Get("Retry-After") != "30" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Expected Retry-After 30 and nothing remaining, got %q and %q", rec.Header().Get("Retry-After"), rec.Header().Get("RateLimit-Remaining"))
+	}
+
+	// Authenticated requests are charged to the user, not the shared IP.
+	s.chirp(token, "Vamonos")
+	if rec := s.do(http.MethodPost, "/api/chirps", token, map[string]string{"body": "Again"}); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the user's second chirp to be limited, got: %d", rec.Code)
+	}
+	s.chirp(signedWith(t, kenny.ID, testAuthSecret), "Same address, different user")
+
+	// Personal access tokens are charged to the address.
+	var pat struct {
+		Token string `json:"token"`
+	}
+	s.decode(s.do(http.MethodPost, "/api/tokens", token, map[string]any{"name": "bot", "scopes": []string{"chirps:write"}}), http.StatusCreated, &pat)
+	before := s.store.authLookups
+	s.chirp(pat.Token, "From the bot")
+	if n := s.store.authLookups - before; n != 2 {
+		t.Errorf("Expected the token and its user to be looked up once each, made %d lookups", n)
+	}
+
+	// Picking a bucket never touches the store, so a limited request costs
+	// no lookups, however bogus its token.
+	for name, token := range map[string]string{"access": token, "personal access": auth.PersonalTokenPrefix + "bogus"} {
+		before := s.store.authLookups
+		if rec := s.do(http.MethodPost, "/api/chirps", token, map[string]string{"body": "Again"}); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected the %s token to be limited, got: %d", name, rec.Code)
+		}
+		if n := s.store.authLookups - before; n != 0 {
+			t.Errorf("Expected a limited %s token request to make no lookups, made %d", name, n)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t, "prod", func(c *config.Config) {
+		c.LockoutThreshold = 2
+		c.RateLimits = ""
+	})
+	admin := s.signup("hank@dea.gov", "They're minerals, Marie!")
+	s.store.admins[admin.ID] = true
+	adminToken := s.login("hank@dea.gov", "They're minerals, Marie!").Token
+	jesse := s.signup("jesse@pinkman.com", "Magnets, yo!")
+	s.signup("skinny@pete.com", "Pete plays the piano, 88 keys")
+	userToken := s.login("skinny@pete.com", "Pete plays the piano, 88 keys").Token
+
+	login := func(password string) *httptest.ResponseRecorder {
+		return s.do(http.MethodPost, "/api/login", "", map[string]string{"email": "jesse@pinkman.com", "password": password})
+	}
+	for i := 0; i < 2; i++ {
+		s.golden("lockout_wrong_password", login("nope"))
+	}
+	s.golden("lockout_locked", login("Magnets, yo!"))
+	locked, _ := s.store.GetUser(context.Background(), jesse.ID)
+	if locked.FailedLoginAttempts != 2 || !locked.LockedUntil.Valid || time.Until(locked.LockedUntil.Time) > time.Minute {
+		t.Errorf("Expected a one minute lock after two failures, got: %+v", locked)
+	}
+
+	// Attempts while locked are not counted; once the lock lapses, the
+	// next failure doubles it.
+	s.store.LockUser(context.Background(), database.LockUserParams{ID: jesse.ID, LockedUntil: sql.NullTime{Time: time.Now(), Valid: true}})
+	login("nope")
+	locked, _ = s.store.GetUser(context.Background(), jesse.ID)
+	if d := time.Until(locked.LockedUntil.Time); d <= time.Minute || d > 2*time.Minute {
+		t.Errorf("Expected the lock to double to two minutes, got: %s", d)
+	}
+
+	unlock := "/admin/users/" + jesse.ID.String() + "/unlock"
+	s.golden("unlock_not_admin", s.do(http.MethodPost, unlock, userToken, nil))
+	s.golden("unlock_unknown_user", s.do(http.MethodPost, "/admin/users/00000000-0000-0000-0000-000000000000/unlock", adminToken, nil))
+	if rec := s.do(http.MethodPost, unlock, adminToken, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 unlocking, got %d: %s", rec.Code, rec.Body.String())
+	}
+	s.login("jesse@pinkman.com", "Magnets, yo!")
+}
+
+func TestLoginUpgradesPasswordHash(t *testing.T) {
+	s := newTestServer(t, "prod", func(c *config.Config) {
+		c.PasswordHash = "bcrypt"
+		c.BcryptCost = 4
+	})
+	user := s.signup("huell@babineaux.com", "Stacks of cash on a bed")
+	stored, _ := s.store.GetUser(context.Background(), user.ID)
+	if !strings.HasPrefix(stored.HashedPassword, "$2a$04$") {
+		t.Fatalf("Expected a cost 4 bcrypt hash, got: %s", stored.HashedPassword)
+	}
+
+	// The same store behind a server that now prefers Argon2id.
+	appConfig := config.Default()
+	appConfig.AuthSecret = testAuthSecret
+	s.handler, _ = newServer(appConfig, s.store, metrics.NewRegistry(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s.login("huell@babineaux.com", "Stacks of cash on a bed")
+	upgraded, _ := s.store.GetUser(context.Background(), user.ID)
+	if !strings.HasPrefix(upgraded.HashedPassword, "$argon2id$v=19$m=19456,t=2,p=1$") || !upgraded.UpdatedAt.Equal(stored.UpdatedAt) {
+		t.Fatalf("Expected the hash to be upgraded in place, got: %+v", upgraded)
+	}
+
+	s.login("huell@babineaux.com", "Stacks of cash on a bed")
+	again, _ := s.store.GetUser(context.Background(), user.ID)
+	if again.HashedPassword != upgraded.HashedPassword {
+		t.Error("Expected a current hash to be left alone")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(private)
+	keyFile := filepath.Join(t.TempDir(), "current.pem")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+
+	s := newTestServer(t, "prod", func(c *config.Config) { c.JWTKeys = "2024-06=" + keyFile })
+	kim := s.signup("kim@wexler.com", "Sandpiper Crossing 2003")
+	token := s.login("kim@wexler.com", "Sandpiper Crossing 2003").Token
+
+	rec := s.do(http.MethodGet, "/.well-known/jwks.json", "", nil)
+	var jwks auth.JWKS
+	s.decode(rec, http.StatusOK, &jwks)
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "2024-06" || jwks.Keys[0].Alg != "EdDSA" {
+		t.Fatalf("Expected the one EdDSA key, got: %+v", jwks)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=300" {
+		t.Errorf("Expected the JWKS to be cacheable, got: %q", got)
+	}
+
+	// Another service verifies the access token with nothing but the JWKS.
+	x, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+	_, err := jwt.Parse(token, func(*jwt.Token) (any, error) { return ed25519.PublicKey(x), nil }, jwt.WithValidMethods([]string{"EdDSA"}))
+	if err != nil {
+		t.Errorf("Expected the token to verify against the published key, got: %v", err)
+	}
+	s.chirp(token, "Verified with a public key")
+	// Without jwt_hmac_cutover, auth_secret no longer vouches for anyone.
+	if rec := s.do(http.MethodPost, "/api/chirps", signedWith(t, kim.ID, testAuthSecret), map[string]string{"body": "hi"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an HS256 token to be refused once jwt_keys is set, got: %d", rec.Code)
+	}
+
+	hmac := newTestServer(t, "prod")
+	s.decode(hmac.do(http.MethodGet, "/.well-known/jwks.json", "", nil), http.StatusOK, &jwks)
+	if len(jwks.Keys) != 0 {
+		t.Errorf("Expected no published keys when signing with auth_secret, got: %+v", jwks)
+	}
+}
+
+func TestHMACCutover(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(private)
+	keyFile := filepath.Join(t.TempDir(), "current.pem")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+
+	cutover := time.Now().Add(-time.Minute).Truncate(time.Second)
+	s := newTestServer(t, "prod", func(c *config.Config) {
+		c.JWTKeys = "2024-06=" + keyFile
+		c.JWTHMACCutover = cutover.Format(time.RFC3339)
+	})
+	mike := s.signup("mike@ehrmantraut.com", "Half measures, Walter")
+	// hs256 signs an access token with auth_secret the way the server did
+	// before jwt_keys, but with any lifetime.
+	hs256 := func(issuedAt time.Time, ttl time.Duration) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    auth.DefaultTokenPolicy.Issuer,
+				Subject:   mike.ID.String(),
+				Audience:  jwt.ClaimStrings{auth.DefaultTokenPolicy.Audience},
+				IssuedAt:  jwt.NewNumericDate(issuedAt),
+				ExpiresAt: jwt.NewNumericDate(issuedAt.Add(ttl)),
+				ID:        uuid.NewString(),
+			},
+			TokenUse: auth.TokenUseAccess,
+		}).SignedString([]byte(testAuthSecret))
+		if err != nil {
+			t.Fatalf("Expected no error signing token, got: %v", err)
+		}
+		return token
+	}
+
+	s.chirp(hs256(cutover.Add(-10*time.Minute), time.Hour), "Issued before the switch")
+	for name, token := range map[string]string{
+		"issued after the cutover": hs256(time.Now(), time.Hour),
+		"longer than a session":    hs256(cutover.Add(-10*time.Minute), 365*24*time.Hour),
+		"forged for a year":        hs256(time.Now(), 365*24*time.Hour),
+	} {
+		if rec := s.do(http.MethodPost, "/api/chirps", token, map[string]string{"body": "hi"}); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected a token %s to be refused, got: %d", name, rec.Code)
+		}
+	}
+}
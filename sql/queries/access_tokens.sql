@@ -0,0 +1,21 @@
+-- name: RevokeAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, expires_at)
+VALUES ($1, $2)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: GetAccessTokenRevocation :one
+SELECT
+	users.token_version,
+	EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = $2) AS revoked
+FROM users
+WHERE users.id = $1;
+
+-- name: PruneRevokedAccessTokens :execrows
+DELETE FROM revoked_access_tokens
+WHERE expires_at < $1;
+
+-- name: BumpTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = $1
+RETURNING token_version;
@@ -0,0 +1,26 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	NULL
+)
+RETURNING *;
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens
+WHERE token_hash = $1;
+
+-- name: RevokeRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = $2, updated_at = $2
+WHERE token_hash = $1 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET revoked_at = $2, updated_at = $2
+WHERE user_id = $1 AND revoked_at IS NULL;
@@ -17,5 +17,39 @@ WHERE id = $1;
 SELECT * FROM users
 WHERE email = $1;
 
+-- name: UpgradeUserToChirpyRed :one
+UPDATE users
+SET is_chirpy_red = TRUE, updated_at = $2
+WHERE id = $1
+RETURNING *;
+
 -- name: Reset :exec
 TRUNCATE TABLE users CASCADE;
+
+-- name: UpdateUser :one
+UPDATE users
+SET email = $2, hashed_password = $3, updated_at = $4
+WHERE id = $1
+RETURNING *;
+
+-- name: RecordFailedLogin :one
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1
+WHERE id = $1
+RETURNING failed_login_attempts;
+
+-- name: LockUser :exec
+UPDATE users
+SET locked_until = $2
+WHERE id = $1;
+
+-- name: ResetLoginFailures :one
+UPDATE users
+SET failed_login_attempts = 0, locked_until = NULL
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdatePasswordHash :exec
+UPDATE users
+SET hashed_password = $2
+WHERE id = $1;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN locked_until TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN locked_until,
+DROP COLUMN failed_login_attempts;
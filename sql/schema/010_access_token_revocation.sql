@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE revoked_access_tokens(
+	jti TEXT PRIMARY KEY,
+	expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX revoked_access_tokens_expires_at_idx ON revoked_access_tokens (expires_at);
+
+ALTER TABLE users
+ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN token_version;
+
+DROP TABLE revoked_access_tokens;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Refresh tokens are kept as the hex SHA-256 of the token, like personal
+-- access tokens, so reading the table does not hand out sessions.
+UPDATE refresh_tokens
+SET token = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+-- +goose Down
+-- Hashes cannot be turned back into tokens; their sessions end.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
@@ -0,0 +1,8 @@
+// Package schema embeds the goose migrations that define the Postgres
+// schema, so the server can apply and verify them itself.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS